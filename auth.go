@@ -1,57 +1,49 @@
 package auth
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
 	ldap "github.com/go-ldap/ldap/v3"
 )
 
 //Authenticate checks if the given credentials are valid, or returns an error if one occurred.
-//username may be either the sAMAccountName or the userPrincipalName.
+//username may be the sAMAccountName, the userPrincipalName, or a down-level logon name (see ParseUsername).
 func Authenticate(config *Config, username, password string) (bool, error) {
-	upn, err := config.UPN(username)
-	if err != nil {
-		return false, err
-	}
+	return AuthenticateContext(context.Background(), config, username, password)
+}
 
-	conn, err := config.Connect()
-	if err != nil {
-		return false, err
+//AuthenticateContext is like Authenticate but connecting and binding are aborted if ctx is done.
+func AuthenticateContext(ctx context.Context, config *Config, username, password string) (bool, error) {
+	conn, status, _, err := authenticate(ctx, config, username, password, false, nil)
+	if conn != nil {
+		conn.Conn.Close()
 	}
-	defer conn.Conn.Close()
-
-	return conn.Bind(upn, password)
+	return status, err
 }
 
 //AuthenticateExtended checks if the given credentials are valid, or returns an error if one occurred.
-//username may be either the sAMAccountName or the userPrincipalName.
+//username may be the sAMAccountName, the userPrincipalName, or a down-level logon name (see ParseUsername).
 //entry is the *ldap.Entry that holds the DN and any request attributes of the user.
 //If groups is non-empty, userGroups will hold which of those groups the user is a member of.
 //groups can be a list of groups referenced by DN or cn and the format provided will be the format returned.
+//Memberships are found according to Config.GroupStrategy.
 func AuthenticateExtended(config *Config, username, password string, attrs, groups []string) (status bool, entry *ldap.Entry, userGroups []string, err error) {
-	upn, err := config.UPN(username)
-	if err != nil {
-		return false, nil, nil, err
-	}
-
-	conn, err := config.Connect()
-	if err != nil {
-		return false, nil, nil, err
-	}
-	defer conn.Conn.Close()
+	return AuthenticateExtendedContext(context.Background(), config, username, password, attrs, groups)
+}
 
-	//bind
-	status, err = conn.Bind(upn, password)
+//AuthenticateExtendedContext is like AuthenticateExtended but connecting, binding and searching are aborted if ctx is done.
+func AuthenticateExtendedContext(ctx context.Context, config *Config, username, password string, attrs, groups []string) (status bool, entry *ldap.Entry, userGroups []string, err error) {
+	conn, status, entry, err := authenticate(ctx, config, username, password, true, attrs)
 	if err != nil {
 		return false, nil, nil, err
 	}
 	if !status {
 		return false, nil, nil, nil
 	}
-
-	//get entry
-	entry, err = conn.GetAttributes("userPrincipalName", upn, attrs)
-	if err != nil {
-		return false, nil, nil, err
-	}
+	defer conn.Conn.Close()
 
 	if len(groups) > 0 {
 		//get all groups
@@ -77,3 +69,230 @@ func AuthenticateExtended(config *Config, username, password string, attrs, grou
 
 	return status, entry, userGroups, nil
 }
+
+//authenticate connects to the server and binds with the given credentials. If the credentials are valid,
+//conn is the connection bound as the user and must be closed by the caller.
+//If lookup is true, entry is the user's entry with the given attributes.
+//If Config.ServiceAccountUPN is set, the user is found by binding as the service account and searching with Config.UserFilter;
+//otherwise the user's userPrincipalName is derived with Config.UPN. NetBIOS domains that aren't in Config.NetBIOSDomains are
+//looked up with Conn.DNSDomain and cached on config; if that fails, the down-level logon name is used. Binds use Config.BindMechanism.
+func authenticate(ctx context.Context, config *Config, username, password string, lookup bool, attrs []string) (conn *Conn, status bool, entry *ldap.Entry, err error) {
+	u, err := ParseUsername(username)
+	if err != nil {
+		//a malformed username can't be valid
+		return nil, false, nil, config.rejected(ErrUserNotFound)
+	}
+
+	if config.ServiceAccountUPN != "" {
+		if !lookup {
+			attrs = []string{""}
+		}
+		return searchBind(ctx, config, u, password, attrs)
+	}
+
+	var bindName string
+	if u.Format == UsernameDownLevel {
+		if domain, ok := config.netBIOSDomain(u.Domain); ok {
+			bindName = fmt.Sprintf("%s@%s", u.User, domain)
+		}
+	} else if bindName, err = config.UPN(username); err != nil {
+		return nil, false, nil, err
+	}
+
+	conn, err = config.ConnectContext(ctx)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	conn = conn.WithContext(ctx)
+
+	unresolved := bindName == ""
+	if unresolved {
+		//servers that allow anonymous reads of the partitions container resolve the NetBIOS domain before the bind
+		if domain, err := conn.DNSDomain(u.Domain); err == nil {
+			bindName, unresolved = fmt.Sprintf("%s@%s", u.User, domain), false
+		} else {
+			//Active Directory accepts down-level logon names directly
+			bindName = u.Domain + `\` + u.User
+		}
+	}
+
+	status, err = conn.bindWith(config.BindMechanism, bindName, password)
+	if err != nil || !status {
+		conn.Conn.Close()
+		return nil, false, nil, err
+	}
+
+	if unresolved {
+		//resolve the domain as the user and cache it, so later calls bind with the userPrincipalName; errors only skip the cache
+		conn.DNSDomain(u.Domain)
+	}
+
+	if lookup {
+		attr, value := "sAMAccountName", u.User
+		if u.Format == UsernameUPN {
+			attr, value = "userPrincipalName", bindName
+		}
+		if entry, err = conn.GetAttributes(attr, value, attrs); err != nil {
+			conn.Conn.Close()
+			return nil, false, nil, err
+		}
+	}
+
+	return conn, true, entry, nil
+}
+
+//searchBind binds as the configured service account, finds the user with Config.UserFilter, and then binds as the user's DN,
+//or with mechanisms other than BindSimple, as their userPrincipalName or sAMAccountName.
+//Down-level logon names are searched for without their domain.
+func searchBind(ctx context.Context, config *Config, u *Username, password string, attrs []string) (conn *Conn, status bool, entry *ldap.Entry, err error) {
+	conn, err = config.ConnectContext(ctx)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	conn = conn.WithContext(ctx)
+
+	fail := func(err error) (*Conn, bool, *ldap.Entry, error) {
+		conn.Conn.Close()
+		return nil, false, nil, err
+	}
+
+	if err = config.bindServiceAccount(conn); err != nil {
+		return fail(err)
+	}
+
+	//only simple binds accept a DN, so other mechanisms bind with the user's userPrincipalName or sAMAccountName
+	var added []string
+	if config.BindMechanism != BindSimple {
+		attrs, added = withAttributes(attrs, "userPrincipalName", "sAMAccountName")
+	}
+
+	filter := config.UserFilter
+	if filter == "" {
+		filter = DefaultUserFilter
+	}
+	username := u.String()
+	if u.Format == UsernameDownLevel {
+		username = u.User
+	}
+	filter = strings.ReplaceAll(filter, "{username}", ldap.EscapeFilter(username))
+
+	entries, err := conn.Search(filter, attrs, 2)
+	if err != nil {
+		var e *ldap.Error
+		if errors.As(err, &e) && e.ResultCode == ldap.LDAPResultSizeLimitExceeded {
+			return fail(fmt.Errorf(`Search error "%s": more than one user found`, filter))
+		}
+		return fail(err)
+	}
+
+	if len(entries) == 0 {
+		return fail(config.rejected(ErrUserNotFound))
+	}
+	if len(entries) > 1 {
+		return fail(fmt.Errorf(`Search error "%s": more than one user found`, filter))
+	}
+
+	entry = entries[0]
+	if config.BindMechanism == BindSimple {
+		status, err = conn.Bind(entry.DN, password)
+		if err != nil || !status {
+			return fail(err)
+		}
+		return conn, true, entry, nil
+	}
+
+	name := entry.GetAttributeValue("userPrincipalName")
+	if name == "" {
+		name = entry.GetAttributeValue("sAMAccountName")
+	}
+	removeAttributes(entry, added)
+
+	//a SASL bind can't replace the security layer installed by the service account's bind, so bind on a new connection
+	if conn.hasSecurityLayer() {
+		conn.Conn.Close()
+		if conn, err = config.ConnectContext(ctx); err != nil {
+			return nil, false, nil, err
+		}
+		conn = conn.WithContext(ctx)
+	}
+
+	status, err = conn.bindWith(config.BindMechanism, name, password)
+	if err != nil || !status {
+		return fail(err)
+	}
+
+	return conn, true, entry, nil
+}
+
+//bindServiceAccount binds conn as the configured service account, using NTLM if Config.ServiceAccountNTHash is set
+//or Config.BindMechanism otherwise.
+func (c *Config) bindServiceAccount(conn *Conn) error {
+	if c.ServiceAccountNTHash == "" && c.BindMechanism == BindSimple {
+		err := conn.bind(c.ServiceAccountUPN, c.ServiceAccountPassword)
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return errors.New("Configuration error: invalid service account credentials")
+		}
+		if err != nil {
+			return fmt.Errorf("Bind error (%s): %w", c.ServiceAccountUPN, err)
+		}
+		return nil
+	}
+
+	var (
+		status bool
+		err    error
+	)
+	if c.ServiceAccountNTHash != "" {
+		status, err = conn.NTLMBindHash(c.ServiceAccountUPN, c.ServiceAccountNTHash)
+	} else {
+		status, err = conn.bindWith(c.BindMechanism, c.ServiceAccountUPN, c.ServiceAccountPassword)
+	}
+
+	var bindErr *BindError
+	if (err == nil && !status) || errors.As(err, &bindErr) {
+		return errors.New("Configuration error: invalid service account credentials")
+	}
+	return err
+}
+
+//withAttributes returns attrs with any of names it doesn't request appended, and the names that were appended.
+//attrs isn't modified.
+func withAttributes(attrs []string, names ...string) (result, added []string) {
+	result = append([]string(nil), attrs...)
+	for _, name := range names {
+		found := false
+		for _, attr := range attrs {
+			if strings.EqualFold(attr, name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, name)
+			added = append(added, name)
+		}
+	}
+	return result, added
+}
+
+//removeAttributes removes the given attributes from entry.
+func removeAttributes(entry *ldap.Entry, names []string) {
+	if len(names) == 0 {
+		return
+	}
+
+	attributes := entry.Attributes[:0]
+	for _, attr := range entry.Attributes {
+		keep := true
+		for _, name := range names {
+			if strings.EqualFold(attr.Name, name) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			attributes = append(attributes, attr)
+		}
+	}
+	entry.Attributes = attributes
+}
@@ -174,3 +174,123 @@ func TestAuthenticateExtended(t *testing.T) {
 		t.Fatalf("Expected sAMAccountName (%s) to be equal to username (%s)", entry.GetAttributeValue("sAMAccountName"), username)
 	}
 }
+
+func TestAuthenticateSearchBind(t *testing.T) {
+	if testConfig.Server == "" {
+		t.Skip("ADTEST_SERVER not set")
+		return
+	}
+
+	if testConfig.BindUPN == "" || testConfig.BindPass == "" {
+		t.Skip("ADTEST_BIND_UPN or ADTEST_BIND_PASS not set")
+		return
+	}
+
+	if testConfig.BaseDN == "" {
+		t.Skip("ADTEST_BASEDN not set")
+		return
+	}
+
+	config := &Config{
+		Server:                 testConfig.Server,
+		Port:                   testConfig.Port,
+		Security:               testConfig.BindSecurity,
+		BaseDN:                 testConfig.BaseDN,
+		ServiceAccountUPN:      testConfig.BindUPN,
+		ServiceAccountPassword: testConfig.BindPass,
+	}
+
+	var username string
+	if splits := strings.Split(testConfig.BindUPN, "@"); len(splits) == 2 {
+		username = splits[0]
+	} else {
+		t.Fatalf("Expected BIND_UPN (%s) to be splittable", testConfig.BindUPN)
+	}
+
+	status, err := Authenticate(config, "go-ad-auth-missing-user", "invalid password")
+	if err != nil {
+		t.Fatal("Missing user: Expected err to be nil but got:", err)
+	}
+	if status {
+		t.Error("Missing user: Expected authenticate status to be false")
+	}
+
+	status, err = Authenticate(config, username, "invalid password")
+	if err != nil {
+		t.Fatal("Invalid credentials: Expected err to be nil but got:", err)
+	}
+	if status {
+		t.Error("Invalid credentials: Expected authenticate status to be false")
+	}
+
+	status, entry, _, err := AuthenticateExtended(config, username, testConfig.BindPass, []string{"userPrincipalName"}, nil)
+	if err != nil {
+		t.Fatal("Valid username: Expected err to be nil but got:", err)
+	}
+	if !status {
+		t.Error("Valid username: Expected authenticate status to be true")
+	}
+	if upn := entry.GetAttributeValue("userPrincipalName"); !strings.EqualFold(upn, testConfig.BindUPN) {
+		t.Errorf("Expected userPrincipalName (%s) to be equal to BIND_UPN (%s)", upn, testConfig.BindUPN)
+	}
+
+	config.UserFilter = "(userPrincipalName={username})"
+	status, err = Authenticate(config, testConfig.BindUPN, testConfig.BindPass)
+	if err != nil {
+		t.Fatal("Custom filter: Expected err to be nil but got:", err)
+	}
+	if !status {
+		t.Error("Custom filter: Expected authenticate status to be true")
+	}
+
+	config.ServiceAccountPassword = "invalid password"
+	if _, err = Authenticate(config, username, testConfig.BindPass); err == nil || !strings.Contains(err.Error(), "service account") {
+		t.Error("Invalid service account: Expected configuration error but got:", err)
+	}
+}
+
+func TestAuthenticateBindMechanism(t *testing.T) {
+	if testConfig.Server == "" {
+		t.Skip("ADTEST_SERVER not set")
+		return
+	}
+
+	if testConfig.BindUPN == "" || testConfig.BindPass == "" {
+		t.Skip("ADTEST_BIND_UPN or ADTEST_BIND_PASS not set")
+		return
+	}
+
+	if testConfig.BaseDN == "" {
+		t.Skip("ADTEST_BASEDN not set")
+		return
+	}
+
+	for _, mechanism := range []BindMechanism{BindNTLM, BindDigestMD5} {
+		config := &Config{Server: testConfig.Server, Port: testConfig.Port, Security: testConfig.BindSecurity, BaseDN: testConfig.BaseDN, BindMechanism: mechanism}
+
+		status, err := Authenticate(config, testConfig.BindUPN, "invalid password")
+		if err != nil || status {
+			t.Errorf("Mechanism %d: Invalid credentials: Expected false and nil err but got: %v, %v", mechanism, status, err)
+		}
+
+		status, err = Authenticate(config, testConfig.BindUPN, testConfig.BindPass)
+		if err != nil || !status {
+			t.Errorf("Mechanism %d: Valid credentials: Expected true and nil err but got: %v, %v", mechanism, status, err)
+		}
+
+		config.ServiceAccountUPN = testConfig.BindUPN
+		config.ServiceAccountPassword = testConfig.BindPass
+
+		status, entry, _, err := AuthenticateExtended(config, testConfig.BindUPN, testConfig.BindPass, []string{"cn"}, nil)
+		if err != nil || !status {
+			t.Errorf("Mechanism %d: Search bind: Expected true and nil err but got: %v, %v", mechanism, status, err)
+		} else if entry.GetAttributeValue("userPrincipalName") != "" {
+			t.Errorf("Mechanism %d: Search bind: Expected userPrincipalName not to be returned", mechanism)
+		}
+	}
+
+	config := &Config{Server: testConfig.Server, Port: testConfig.Port, Security: testConfig.BindSecurity, BaseDN: testConfig.BaseDN, BindMechanism: -1}
+	if _, err := Authenticate(config, testConfig.BindUPN, testConfig.BindPass); err == nil || !strings.Contains(err.Error(), "BindMechanism") {
+		t.Error("Invalid mechanism: Expected configuration error but got:", err)
+	}
+}
@@ -14,6 +14,7 @@ var testConfig struct {
 	BindSecurity SecurityType
 	BaseDN       string
 	PasswordUPN  string
+	AdminOU      string
 }
 
 func init() {
@@ -49,4 +50,5 @@ func init() {
 
 	testConfig.BaseDN = os.Getenv("ADTEST_BASEDN")
 	testConfig.PasswordUPN = os.Getenv("ADTEST_PASSWORD_UPN")
+	testConfig.AdminOU = os.Getenv("ADTEST_ADMIN_OU")
 }
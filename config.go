@@ -1,11 +1,12 @@
 package auth
 
 import (
+	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"fmt"
-	"net/mail"
 	"strings"
+	"time"
 )
 
 //SecurityType specifies the type of security to use when connecting to an Active Directory Server.
@@ -18,15 +19,150 @@ const (
 	SecurityStartTLS
 	SecurityInsecureTLS
 	SecurityInsecureStartTLS
+	//SecurityPinnedTLS is like SecurityTLS, but the server's certificate is checked against Config.Pins instead of RootCAs.
+	//It's for servers whose certificates aren't issued by a CA the client trusts but are known ahead of time.
+	SecurityPinnedTLS
+	//SecurityPinnedStartTLS is like SecurityStartTLS, but the server's certificate is checked against Config.Pins instead of RootCAs.
+	SecurityPinnedStartTLS
 )
 
+//ServerSelection specifies the order in which servers are tried when connecting.
+type ServerSelection int
+
+//Selection will default to SelectInOrder if not given.
+const (
+	SelectInOrder ServerSelection = iota
+	SelectRandom
+)
+
+//GroupStrategy specifies how the groups an object is a member of are found.
+type GroupStrategy int
+
+//GroupStrategy will default to GroupsMatchingRuleInChain if not given.
+const (
+	//GroupsMatchingRuleInChain searches for groups with LDAP_MATCHING_RULE_IN_CHAIN. It finds nested security and distribution groups,
+	//but can be very slow on large directories.
+	GroupsMatchingRuleInChain GroupStrategy = iota
+	//GroupsTokenGroups reads the constructed tokenGroups attribute of the object and resolves the returned SIDs in batches.
+	//It is much faster on large directories and includes the primary group, but only finds security groups.
+	GroupsTokenGroups
+)
+
+//SASLProtection specifies how traffic is protected after a SASL bind, e.g. with Conn.GSSAPIBind.
+type SASLProtection int
+
+//Protection will default to ProtectionAuto if not given.
+const (
+	//ProtectionAuto seals traffic on connections made with SecurityNone if the server allows it, or signs it if the server only allows signing.
+	//Traffic over TLS is already protected, so no SASL protection is added.
+	ProtectionAuto SASLProtection = iota
+	//ProtectionNone only authenticates the connection.
+	ProtectionNone
+	//ProtectionSign adds integrity protection (LDAP signing) to all traffic after the bind.
+	ProtectionSign
+	//ProtectionSeal adds integrity and confidentiality protection (LDAP sealing) to all traffic after the bind.
+	ProtectionSeal
+)
+
+//BindMechanism specifies how Authenticate, AuthenticateExtended and Pool bind.
+type BindMechanism int
+
+//BindMechanism will default to BindSimple if not given.
+const (
+	//BindSimple performs a simple bind with the user's userPrincipalName (see Conn.Bind).
+	BindSimple BindMechanism = iota
+	//BindNTLM performs an NTLM bind (see Conn.NTLMBind).
+	BindNTLM
+	//BindDigestMD5 performs a SASL DIGEST-MD5 bind, which signs traffic on connections made with SecurityNone (see Conn.DigestMD5Bind).
+	BindDigestMD5
+)
+
+//DefaultServerCooldown is used when Config.ServerCooldown is not given.
+const DefaultServerCooldown = 30 * time.Second
+
+//DefaultUserFilter is used to find users when Config.UserFilter is not given.
+const DefaultUserFilter = "(&(objectCategory=person)(objectClass=user)(|(sAMAccountName={username})(userPrincipalName={username})))"
+
+//DefaultPageSize is used when Config.PageSize is not given. It matches Active Directory's default MaxPageSize.
+const DefaultPageSize = 1000
+
 //Config contains settings for connecting to an Active Directory server.
 type Config struct {
-	Server   string
-	Port     int
+	Server string
+	Port   int
+	//Servers is an optional list of additional servers, e.g. other domain controllers, to try if Server can't be reached.
+	//Each server is given as "host" or "host:port". If no port is given, Port is used.
+	Servers []string
+	//Selection controls the order Server and Servers are tried in.
+	Selection ServerSelection
+	//ServerCooldown is how long a server that failed to connect is tried only after all other servers.
+	//If negative, failed servers are not remembered.
+	ServerCooldown time.Duration
+	//Site is the Active Directory site used by DiscoverServers to prefer nearby domain controllers.
+	Site string
+	//Resolver is used by DiscoverServers to look up SRV records. If nil, net.DefaultResolver is used.
+	Resolver Resolver
 	BaseDN   string
 	Security SecurityType
 	RootCAs  *x509.CertPool
+	//Certificates are presented to the server when it requests a TLS client certificate, e.g. for Conn.ExternalBind.
+	Certificates []tls.Certificate
+	//GetClientCertificate, if set, is called to choose the client certificate instead of using Certificates (see tls.Config).
+	GetClientCertificate func(*tls.CertificateRequestInfo) (*tls.Certificate, error)
+	//Pins are the base64 SHA-256 hashes of the public keys (SPKI) accepted with SecurityPinnedTLS and SecurityPinnedStartTLS.
+	//A server is accepted if its certificate's key is pinned, or if its chain is valid for its hostname up to a certificate
+	//whose key is pinned, e.g. an issuing CA. The pinned certificate may be one the server presents, or one in a chain
+	//built with RootCAs (or the system roots if not set), e.g. a root CA the server doesn't send.
+	//Use CertificatePin or InspectCertificates to get pins.
+	//TLS sessions aren't resumed in the pinned modes, so every connection is checked against Pins.
+	Pins []string
+	//TLSConfig, if set, is the base configuration for SecurityTLS and SecurityStartTLS and their insecure and pinned variants,
+	//e.g. to set MinVersion, CipherSuites or VerifyConnection. It's cloned for every connection.
+	//RootCAs, Certificates and GetClientCertificate take precedence over the matching TLSConfig fields if set.
+	TLSConfig *tls.Config
+	//ServerName, if set, is the hostname used to verify server certificates and sent with SNI instead of the server's host,
+	//e.g. so Server can be an IP address. It takes precedence over TLSConfig.ServerName, and is also used as the host in
+	//service principal names and DIGEST-MD5 digest-uris.
+	ServerName string
+	//DetailedErrors makes Bind, Authenticate and AuthenticateExtended return a *BindError describing why the server rejected
+	//the credentials, e.g. a locked or disabled account, instead of returning false and a nil error.
+	DetailedErrors bool
+	//ServiceAccountUPN and ServiceAccountPassword, if set, change how Authenticate, AuthenticateExtended and UpdatePassword find users:
+	//they bind as the service account, search for the user with UserFilter, and then bind as the found user's DN.
+	//This allows users to log in with any attribute UserFilter matches, e.g. mail or employeeID.
+	ServiceAccountUPN      string
+	ServiceAccountPassword string
+	//ServiceAccountNTHash, if set, is the hex NT hash the service account binds with using NTLM instead of ServiceAccountPassword
+	//(pass-the-hash). ServiceAccountUPN must then be a sAMAccountName or down-level logon name, e.g. "CORP\svc-app".
+	ServiceAccountNTHash string
+	//UserFilter is the LDAP filter used to find users when ServiceAccountUPN is set. Every "{username}" is replaced with
+	//the escaped username. If not given, DefaultUserFilter is used.
+	UserFilter string
+	//NetBIOSDomains maps NetBIOS domain names, e.g. "CORP", to DNS domains, e.g. "corp.example.com".
+	//It is used to convert down-level logon names like "CORP\jdoe" to userPrincipalNames.
+	NetBIOSDomains map[string]string
+	//PageSize is the number of entries retrieved at a time by Search and SearchPages. If 0, DefaultPageSize is used.
+	PageSize uint32
+	//GroupStrategy controls how ObjectGroups and AuthenticateExtended find the groups an object is a member of.
+	GroupStrategy GroupStrategy
+	//IncludePrimaryGroup makes ObjectGroups and AuthenticateExtended also find the object's primary group, e.g. Domain Users,
+	//and the groups it is nested in, matching the groups Windows puts in the user's access token.
+	//The primary group is always included with GroupsTokenGroups.
+	IncludePrimaryGroup bool
+	//BindMechanism controls how Authenticate, AuthenticateExtended, UpdatePassword and Pool bind.
+	BindMechanism BindMechanism
+	//Kerberos holds the credentials used by Conn.GSSAPIBind.
+	Kerberos *KerberosConfig
+
+	//resolved caches NetBIOS domain names found by Conn.DNSDomain
+	resolved *netBIOSCache
+}
+
+func (c *Config) pageSize() uint32 {
+	if c.PageSize == 0 {
+		return DefaultPageSize
+	}
+	return c.PageSize
 }
 
 //Domain returns the domain derived from BaseDN or an error if misconfigured.
@@ -44,11 +180,33 @@ func (c *Config) Domain() (string, error) {
 }
 
 //UPN returns the userPrincipalName for the given username or an error if misconfigured.
+//username may be given in any format understood by ParseUsername. As in earlier versions, usernames containing "@" are returned
+//unchanged, unless the suffix is a known NetBIOS domain name, e.g. "jdoe@CORP".
+//Down-level logon names, e.g. "CORP\jdoe", are mapped with NetBIOSDomains or domains previously found by Conn.DNSDomain,
+//and an error wrapping ErrUnknownDomain is returned if the name isn't known.
 func (c *Config) UPN(username string) (string, error) {
-	if _, err := mail.ParseAddress(username); err == nil {
+	if strings.Contains(username, "@") {
+		if u, err := ParseUsername(username); err == nil && u.Format == UsernameDownLevel {
+			if domain, ok := c.netBIOSDomain(u.Domain); ok {
+				return fmt.Sprintf("%s@%s", u.User, domain), nil
+			}
+		}
 		return username, nil
 	}
 
+	u, err := ParseUsername(username)
+	if err != nil {
+		return "", err
+	}
+
+	if u.Format == UsernameDownLevel {
+		domain, ok := c.netBIOSDomain(u.Domain)
+		if !ok {
+			return "", fmt.Errorf("Configuration error: %w: %s", ErrUnknownDomain, u.Domain)
+		}
+		return fmt.Sprintf("%s@%s", u.User, domain), nil
+	}
+
 	domain, err := c.Domain()
 	if err != nil {
 		return "", err
@@ -1,9 +1,12 @@
 package auth
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"net"
+	"sync"
 
 	ldap "github.com/go-ldap/ldap/v3"
 )
@@ -12,70 +15,324 @@ import (
 type Conn struct {
 	Conn   *ldap.Conn
 	Config *Config
+	ctx    context.Context
+	bound  *bindState
+	//host is the server's hostname, used to verify its certificate and in service principal names
+	host string
+	//sasl is the connection's SASL framing, or nil if a security layer can't be installed, e.g. over TLS
+	sasl *saslConn
+}
+
+//bindState tracks the identity a connection is bound as. It is shared between copies made with WithContext.
+type bindState struct {
+	mu       sync.Mutex
+	identity string
+}
+
+//setBound records the identity the connection is bound as. An empty identity means anonymous.
+func (c *Conn) setBound(identity string) {
+	if c.bound == nil {
+		return
+	}
+	c.bound.mu.Lock()
+	c.bound.identity = identity
+	c.bound.mu.Unlock()
+}
+
+//boundAs returns the identity the connection is bound as, or an empty string if anonymous or unknown.
+func (c *Conn) boundAs() string {
+	if c.bound == nil {
+		return ""
+	}
+	c.bound.mu.Lock()
+	defer c.bound.mu.Unlock()
+	return c.bound.identity
 }
 
 //Connect returns an open connection to an Active Directory server or an error if one occurred.
+//If multiple servers are configured, they are tried according to Config.Selection until one succeeds.
 func (c *Config) Connect() (*Conn, error) {
-	switch c.Security {
-	case SecurityNone:
-		conn, err := ldap.Dial("tcp", fmt.Sprintf("%s:%d", c.Server, c.Port))
-		if err != nil {
-			return nil, fmt.Errorf("Connection error: %w", err)
-		}
-		return &Conn{Conn: conn, Config: c}, nil
-	case SecurityTLS:
-		conn, err := ldap.DialTLS("tcp", fmt.Sprintf("%s:%d", c.Server, c.Port), &tls.Config{ServerName: c.Server, RootCAs: c.RootCAs})
-		if err != nil {
-			return nil, fmt.Errorf("Connection error: %w", err)
-		}
-		return &Conn{Conn: conn, Config: c}, nil
-	case SecurityStartTLS:
-		conn, err := ldap.Dial("tcp", fmt.Sprintf("%s:%d", c.Server, c.Port))
-		if err != nil {
-			return nil, fmt.Errorf("Connection error: %w", err)
+	return c.ConnectContext(context.Background())
+}
+
+//ConnectContext is like Connect but dialing and any TLS handshake are aborted if ctx is done.
+//ctx is only used while connecting; use Conn.WithContext to bind later operations to a context.
+func (c *Config) ConnectContext(ctx context.Context) (*Conn, error) {
+	if c.Security < SecurityNone || c.Security > SecurityPinnedStartTLS {
+		return nil, errors.New("Configuration error: invalid SecurityType")
+	}
+	if c.Security == SecurityPinnedTLS || c.Security == SecurityPinnedStartTLS {
+		if err := c.checkPins(); err != nil {
+			return nil, err
 		}
-		err = conn.StartTLS(&tls.Config{ServerName: c.Server, RootCAs: c.RootCAs})
-		if err != nil {
-			return nil, fmt.Errorf("Connection error: %w", err)
+	}
+
+	servers := c.servers()
+
+	var err error
+	for _, s := range servers {
+		var conn *Conn
+		if conn, err = c.dial(ctx, s); err == nil {
+			serverHealth.succeed(s.addr)
+			return conn, nil
 		}
-		return &Conn{Conn: conn, Config: c}, nil
-	case SecurityInsecureTLS:
-		conn, err := ldap.DialTLS("tcp", fmt.Sprintf("%s:%d", c.Server, c.Port), &tls.Config{ServerName: c.Server, InsecureSkipVerify: true})
-		if err != nil {
-			return nil, fmt.Errorf("Connection error: %w", err)
+
+		//the server isn't at fault if the caller gave up
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("Connection error: %w", ctx.Err())
 		}
-		return &Conn{Conn: conn, Config: c}, nil
-	case SecurityInsecureStartTLS:
-		conn, err := ldap.Dial("tcp", fmt.Sprintf("%s:%d", c.Server, c.Port))
-		if err != nil {
-			return nil, fmt.Errorf("Connection error: %w", err)
+		serverHealth.fail(s.addr, c.ServerCooldown)
+	}
+
+	if len(servers) > 1 {
+		return nil, fmt.Errorf("Connection error: all %d servers failed, last error: %w", len(servers), err)
+	}
+	return nil, fmt.Errorf("Connection error: %w", err)
+}
+
+//dial connects to the given server using the configured SecurityType.
+func (c *Config) dial(ctx context.Context, s server) (*Conn, error) {
+	d := &net.Dialer{Timeout: ldap.DefaultTimeout}
+	raw, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Security == SecurityTLS || c.Security == SecurityInsecureTLS || c.Security == SecurityPinnedTLS {
+		tlsConn := tls.Client(raw, c.tlsConfig(s))
+		if err = withContext(ctx, func() { raw.Close() }, tlsConn.Handshake); err != nil {
+			raw.Close()
+			return nil, err
 		}
-		err = conn.StartTLS(&tls.Config{ServerName: c.Server, InsecureSkipVerify: true})
-		if err != nil {
-			return nil, fmt.Errorf("Connection error: %w", err)
+
+		conn := ldap.NewConn(tlsConn, true)
+		conn.Start()
+		return &Conn{Conn: conn, Config: c, bound: new(bindState), host: c.serverName(s)}, nil
+	}
+
+	if c.Security == SecurityNone {
+		sasl := newSASLConn(raw)
+		conn := ldap.NewConn(sasl, false)
+		conn.Start()
+		return &Conn{Conn: conn, Config: c, bound: new(bindState), host: c.serverName(s), sasl: sasl}, nil
+	}
+
+	conn := ldap.NewConn(raw, false)
+	conn.Start()
+
+	err = withContext(ctx, func() { conn.Close() }, func() error {
+		return conn.StartTLS(c.tlsConfig(s))
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Conn{Conn: conn, Config: c, bound: new(bindState), host: c.serverName(s)}, nil
+}
+
+//tlsConfig returns the *tls.Config used to connect to the given server.
+func (c *Config) tlsConfig(s server) *tls.Config {
+	config := new(tls.Config)
+	if c.TLSConfig != nil {
+		config = c.TLSConfig.Clone()
+	}
+
+	config.ServerName = c.serverName(s)
+	if c.RootCAs != nil {
+		config.RootCAs = c.RootCAs
+	}
+	if c.Certificates != nil {
+		config.Certificates = c.Certificates
+	}
+	if c.GetClientCertificate != nil {
+		config.GetClientCertificate = c.GetClientCertificate
+	}
+
+	switch c.Security {
+	case SecurityInsecureTLS, SecurityInsecureStartTLS:
+		config.InsecureSkipVerify = true
+	case SecurityPinnedTLS, SecurityPinnedStartTLS:
+		//the chain is verified against the pins instead, with RootCAs used to find pinned certificates the server doesn't send.
+		//VerifyPeerCertificate isn't called for resumed sessions, so sessions from TLSConfig.ClientSessionCache,
+		//which may not have been pinned, are never resumed
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = c.verifyPins(config.ServerName, config.RootCAs, config.VerifyPeerCertificate)
+		config.ClientSessionCache = nil
+	}
+	return config
+}
+
+//serverName returns the hostname of the given server: Config.ServerName, TLSConfig.ServerName, or the server's host.
+func (c *Config) serverName(s server) string {
+	if c.ServerName != "" {
+		return c.ServerName
+	}
+	if c.TLSConfig != nil && c.TLSConfig.ServerName != "" {
+		return c.TLSConfig.ServerName
+	}
+	return s.host
+}
+
+//WithContext returns a shallow copy of c whose operations are aborted if ctx is done.
+//Since LDAP has no way to cancel an in-flight bind, aborting an operation closes the underlying connection.
+func (c *Conn) WithContext(ctx context.Context) *Conn {
+	if ctx == nil {
+		panic("nil context")
+	}
+	c2 := *c
+	c2.ctx = ctx
+	return &c2
+}
+
+//Context returns the connection's context, which defaults to context.Background.
+func (c *Conn) Context() context.Context {
+	if c.ctx != nil {
+		return c.ctx
+	}
+	return context.Background()
+}
+
+//do runs fn, closing the connection if the connection's context is done first.
+func (c *Conn) do(fn func() error) error {
+	return withContext(c.Context(), func() { c.Conn.Close() }, fn)
+}
+
+//withContext runs fn, calling abort if ctx is done before fn returns.
+//If fn was aborted, ctx.Err() is returned instead of fn's error.
+func withContext(ctx context.Context, abort func(), fn func() error) error {
+	if ctx.Done() == nil {
+		return fn()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	aborted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			abort()
+			aborted <- true
+		case <-stop:
+			aborted <- false
 		}
-		return &Conn{Conn: conn, Config: c}, nil
-	default:
-		return nil, errors.New("Configuration error: invalid SecurityType")
+	}()
+
+	err := fn()
+	close(stop)
+	if <-aborted {
+		return ctx.Err()
 	}
+	return err
 }
 
 //Bind authenticates the connection with the given userPrincipalName and password
 //and returns the result or an error if one occurred.
+//If Config.DetailedErrors is set, invalid credentials are reported as a *BindError instead of false and a nil error.
 func (c *Conn) Bind(upn, password string) (bool, error) {
 	if password == "" {
+		return c.rejectEmptyPassword()
+	}
+
+	return c.bindResult(upn, c.bind(upn, password))
+}
+
+//rejectEmptyPassword returns the result of a bind with an empty password, which the server would treat as an unauthenticated bind.
+func (c *Conn) rejectEmptyPassword() (bool, error) {
+	if c.Config != nil {
+		return false, c.Config.rejected(ErrInvalidCredentials)
+	}
+	return false, nil
+}
+
+//bindResult returns the result of a bind as name that returned err. Invalid credentials are reported as false and a nil error,
+//or as a *BindError if Config.DetailedErrors is set.
+func (c *Conn) bindResult(name string, err error) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+
+	var e *ldap.Error
+	if errors.As(err, &e) && e.ResultCode == ldap.LDAPResultInvalidCredentials {
+		if c.Config != nil && c.Config.DetailedErrors {
+			return false, newBindError(e)
+		}
 		return false, nil
 	}
 
-	err := c.Conn.Bind(upn, password)
-	if err != nil {
-		if e, ok := err.(*ldap.Error); ok {
-			if e.ResultCode == ldap.LDAPResultInvalidCredentials {
-				return false, nil
-			}
+	return false, fmt.Errorf("Bind error (%s): %w", name, err)
+}
+
+//bind performs a simple bind and records the connection's identity.
+func (c *Conn) bind(upn, password string) error {
+	return c.bindAs(upn, func() error {
+		return c.Conn.Bind(upn, password)
+	})
+}
+
+//bindAs runs the bind fn and records the connection's identity as identity if it succeeds.
+func (c *Conn) bindAs(identity string, fn func() error) error {
+	if err := c.do(fn); err != nil {
+		//a failed bind leaves the connection anonymous
+		c.setBound("")
+		return err
+	}
+
+	c.setBound(identity)
+	return nil
+}
+
+//BindContext is like Bind but the bind is aborted if ctx is done.
+func (c *Conn) BindContext(ctx context.Context, upn, password string) (bool, error) {
+	return c.WithContext(ctx).Bind(upn, password)
+}
+
+//bindWith binds with the given mechanism and returns the result or an error if one occurred.
+func (c *Conn) bindWith(mechanism BindMechanism, username, password string) (bool, error) {
+	switch mechanism {
+	case BindSimple:
+		return c.Bind(username, password)
+	case BindNTLM:
+		return c.NTLMBind(username, password)
+	case BindDigestMD5:
+		return c.DigestMD5Bind(username, password)
+	}
+	return false, errors.New("Configuration error: invalid BindMechanism")
+}
+
+//ExternalBind authenticates the connection with SASL EXTERNAL, i.e. as the account the TLS client certificate from
+//Config.Certificates or Config.GetClientCertificate is mapped to, or returns an error if one occurred.
+//The connection must have been made with SecurityTLS or SecurityStartTLS (or their insecure or pinned variants).
+func (c *Conn) ExternalBind() error {
+	if _, ok := c.Conn.TLSConnectionState(); !ok {
+		return errors.New("Bind error (EXTERNAL): connection doesn't use TLS")
+	}
+
+	var identity string
+	err := c.do(func() error {
+		if err := c.Conn.ExternalBind(); err != nil {
+			return err
+		}
+
+		//the identity comes from the server's certificate mapping, so ask the server for it
+		if result, err := c.Conn.WhoAmI(nil); err == nil {
+			identity = result.AuthzID
 		}
-		return false, fmt.Errorf("Bind error (%s): %w", upn, err)
+		return nil
+	})
+	if err != nil {
+		//a failed bind leaves the connection anonymous
+		c.setBound("")
+		return fmt.Errorf("Bind error (EXTERNAL): %w", err)
 	}
 
-	return true, nil
+	c.setBound(identity)
+	return nil
+}
+
+//ExternalBindContext is like ExternalBind but the bind is aborted if ctx is done.
+func (c *Conn) ExternalBindContext(ctx context.Context) error {
+	return c.WithContext(ctx).ExternalBind()
 }
@@ -1,7 +1,11 @@
 package auth
 
 import (
+	"context"
+	"errors"
+	"net"
 	"testing"
+	"time"
 )
 
 func TestConfigConnect(t *testing.T) {
@@ -47,6 +51,111 @@ func TestConfigConnect(t *testing.T) {
 	}
 }
 
+func TestConfigConnectFailover(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error starting listener:", err)
+	}
+	defer l.Close()
+
+	config := &Config{Servers: []string{"127.0.0.1:1", l.Addr().String()}, Security: SecurityNone}
+	conn, err := config.Connect()
+	if err != nil {
+		t.Fatal("Failover: Expected connect error to be nil but got:", err)
+	}
+	conn.Conn.Close()
+
+	if serverHealth.healthy("127.0.0.1:1") {
+		t.Error("Failover: Expected failed server to be marked unhealthy")
+	}
+
+	if servers := config.servers(); servers[0].addr != l.Addr().String() {
+		t.Error("Failover: Expected healthy server to be tried first but got:", servers[0].addr)
+	}
+
+	config = &Config{Servers: []string{"127.0.0.1:1"}, Security: SecurityNone, ServerCooldown: -1}
+	if _, err = config.Connect(); err == nil {
+		t.Error("Failover: Expected connect error but got nil")
+	}
+
+	config = &Config{Server: "127.0.0.1", Port: 2, Servers: []string{"127.0.0.1:3"}, Security: SecurityNone}
+	if _, err = config.Connect(); err == nil {
+		t.Error("Failover: Expected connect error but got nil")
+	}
+}
+
+func TestConfigConnectContext(t *testing.T) {
+	//listener accepts connections but never responds
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error starting listener:", err)
+	}
+	defer l.Close()
+
+	config := &Config{Servers: []string{l.Addr().String()}, Security: SecurityTLS}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = config.ConnectContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("SecurityTLS: Expected deadline exceeded error but got:", err)
+	}
+
+	if !serverHealth.healthy(l.Addr().String()) {
+		t.Error("Expected server not to be marked unhealthy after context deadline")
+	}
+
+	config.Security = SecurityStartTLS
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = config.ConnectContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("SecurityStartTLS: Expected deadline exceeded error but got:", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err = config.ConnectContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Error("Canceled: Expected canceled error but got:", err)
+	}
+
+	config.Security = SecurityNone
+	conn, err := config.Connect()
+	if err != nil {
+		t.Fatal("SecurityNone: Expected connect error to be nil but got:", err)
+	}
+	defer conn.Conn.Close()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = conn.BindContext(ctx, "test@example.com", "password"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Bind: Expected deadline exceeded error but got:", err)
+	}
+}
+
+func TestConfigServers(t *testing.T) {
+	config := &Config{Server: "dc1.example.com", Port: 636, Servers: []string{"dc2.example.com", "dc3.example.com:3269", "::1"}}
+	expected := []server{
+		{host: "dc1.example.com", addr: "dc1.example.com:636"},
+		{host: "dc2.example.com", addr: "dc2.example.com:636"},
+		{host: "dc3.example.com", addr: "dc3.example.com:3269"},
+		{host: "::1", addr: "[::1]:636"},
+	}
+
+	servers := config.servers()
+	if len(servers) != len(expected) {
+		t.Fatalf("Expected %d servers but got %d", len(expected), len(servers))
+	}
+	for i := range expected {
+		if servers[i] != expected[i] {
+			t.Errorf("Expected server %d to be %v but got %v", i, expected[i], servers[i])
+		}
+	}
+
+	config.Selection = SelectRandom
+	if servers = config.servers(); len(servers) != len(expected) {
+		t.Errorf("Random: Expected %d servers but got %d", len(expected), len(servers))
+	}
+}
+
 func TestConnBind(t *testing.T) {
 	if testConfig.Server == "" {
 		t.Skip("ADTEST_SERVER not set")
@@ -76,4 +185,19 @@ func TestConnBind(t *testing.T) {
 	if status, _ := conn.Bind(testConfig.BindUPN, testConfig.BindPass); !status {
 		t.Error("Valid credentials: Expected authentication status to be true")
 	}
+
+	config.DetailedErrors = true
+
+	if _, err = conn.Bind("test", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Error("Detailed empty password: Expected invalid credentials error but got:", err)
+	}
+
+	var bindErr *BindError
+	if _, err = conn.Bind(testConfig.BindUPN, "invalid_password"); !errors.As(err, &bindErr) {
+		t.Error("Detailed invalid credentials: Expected *BindError but got:", err)
+	}
+
+	if status, err := conn.Bind(testConfig.BindUPN, testConfig.BindPass); !status || err != nil {
+		t.Error("Detailed valid credentials: Expected authentication status to be true but got:", err)
+	}
 }
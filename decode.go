@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+//UnmarshalEntry fills the struct pointed to by v with the attributes of entry.
+//Fields are matched to attributes with `ad:"attributeName"` tags; the special tag `ad:"dn"` is filled with the entry's DN.
+//Untagged fields, fields tagged `ad:"-"`, and fields whose attribute is missing are left unchanged.
+//
+//Supported field types are string, bool, integers, time.Time, []byte, SID, GUID, UserAccountControl, GroupType,
+//any type implementing encoding.BinaryUnmarshaler or encoding.TextUnmarshaler, and pointers and slices of these.
+//time.Time fields accept both GeneralizedTime (e.g. whenCreated) and Windows FILETIME (e.g. pwdLastSet) values.
+func UnmarshalEntry(entry *ldap.Entry, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("Decode error: v must be a non-nil pointer to a struct")
+	}
+
+	if err := unmarshalStruct(entry, rv.Elem()); err != nil {
+		return fmt.Errorf("Decode error: %w", err)
+	}
+
+	return nil
+}
+
+func unmarshalStruct(entry *ldap.Entry, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+
+		tag := field.Tag.Get("ad")
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			if err := unmarshalStruct(entry, rv.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if tag == "" || tag == "-" || field.PkgPath != "" {
+			continue
+		}
+
+		if tag == "dn" {
+			if field.Type.Kind() != reflect.String {
+				return fmt.Errorf("%s: dn field must be a string", field.Name)
+			}
+			rv.Field(i).SetString(entry.DN)
+			continue
+		}
+
+		var attr *ldap.EntryAttribute
+		for _, a := range entry.Attributes {
+			if strings.EqualFold(a.Name, tag) {
+				attr = a
+				break
+			}
+		}
+		if attr == nil || len(attr.Values) == 0 {
+			continue
+		}
+
+		if err := unmarshalAttribute(rv.Field(i), attr); err != nil {
+			return fmt.Errorf("%s: %w", tag, err)
+		}
+	}
+
+	return nil
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	byteType = reflect.TypeOf(byte(0))
+)
+
+func unmarshalAttribute(rv reflect.Value, attr *ldap.EntryAttribute) error {
+	t := rv.Type()
+
+	//[]byte holds a single raw value, other slices hold one element per value
+	if t.Kind() == reflect.Slice && t.Elem() != byteType {
+		slice := reflect.MakeSlice(t, len(attr.Values), len(attr.Values))
+		for idx := range attr.Values {
+			if err := unmarshalValue(slice.Index(idx), attr.Values[idx], attr.ByteValues[idx]); err != nil {
+				return err
+			}
+		}
+		rv.Set(slice)
+		return nil
+	}
+
+	return unmarshalValue(rv, attr.Values[0], attr.ByteValues[0])
+}
+
+func unmarshalValue(rv reflect.Value, value string, raw []byte) error {
+	t := rv.Type()
+
+	if t.Kind() == reflect.Ptr {
+		ptr := reflect.New(t.Elem())
+		if err := unmarshalValue(ptr.Elem(), value, raw); err != nil {
+			return err
+		}
+		rv.Set(ptr)
+		return nil
+	}
+
+	//time.Time implements both unmarshaler interfaces with its own formats
+	if t == timeType {
+		tm, err := parseADTime(value)
+		if err != nil {
+			return err
+		}
+		rv.Set(reflect.ValueOf(tm))
+		return nil
+	}
+
+	if u, ok := rv.Addr().Interface().(encoding.BinaryUnmarshaler); ok {
+		return u.UnmarshalBinary(raw)
+	}
+
+	if u, ok := rv.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		rv.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		rv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, t.Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		//flag attributes like userAccountControl and groupType are stored as signed 32-bit integers
+		if t.Bits() == 32 {
+			flags, err := parseFlags(value)
+			if err != nil {
+				return err
+			}
+			rv.SetUint(uint64(flags))
+			return nil
+		}
+		u, err := strconv.ParseUint(value, 10, t.Bits())
+		if err != nil {
+			return err
+		}
+		rv.SetUint(u)
+	case reflect.Slice:
+		//[]byte
+		buf := make([]byte, len(raw))
+		copy(buf, raw)
+		rv.SetBytes(buf)
+	default:
+		return fmt.Errorf("unsupported type %s", t)
+	}
+
+	return nil
+}
+
+//parseADTime parses a GeneralizedTime (e.g. "20060102150405.0Z") or FILETIME (e.g. "133420185600000000") value.
+func parseADTime(value string) (time.Time, error) {
+	if strings.Trim(value, "0123456789-") == "" {
+		return ParseFileTime(value)
+	}
+	return ParseGeneralizedTime(value)
+}
+
+//attributesOf returns the attribute names tagged in the struct type t.
+func attributesOf(t reflect.Type) []string {
+	var attrs []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("ad")
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			attrs = append(attrs, attributesOf(field.Type)...)
+			continue
+		}
+		if tag == "" || tag == "-" || tag == "dn" || field.PkgPath != "" {
+			continue
+		}
+		attrs = append(attrs, tag)
+	}
+	return attrs
+}
+
+//GetObject fills the struct pointed to by v (see UnmarshalEntry) for the object with the given attribute value
+//or returns an error if one occurred. Only the attributes tagged in v are requested. attr and value are sanitized.
+func (c *Conn) GetObject(attr, value string, v interface{}) error {
+	return c.getObject(fmt.Sprintf("(%s=%s)", ldap.EscapeFilter(attr), ldap.EscapeFilter(value)), v)
+}
+
+//GetObjectByGUID is like GetObject but finds the object by objectGUID.
+func (c *Conn) GetObjectByGUID(guid GUID, v interface{}) error {
+	return c.getObject(fmt.Sprintf("(objectGUID=%s)", guid.FilterString()), v)
+}
+
+func (c *Conn) getObject(filter string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("Decode error: v must be a non-nil pointer to a struct")
+	}
+
+	entry, err := c.SearchOne(filter, attributesOf(rv.Elem().Type()))
+	if err != nil {
+		return err
+	}
+
+	if err = unmarshalStruct(entry, rv.Elem()); err != nil {
+		return fmt.Errorf("Decode error (%s): %w", entry.DN, err)
+	}
+
+	return nil
+}
+
+//SearchObjects fills the slice pointed to by v with the entries for the given search criteria or returns an error if one occurred.
+//v must be a pointer to a slice of structs or struct pointers (see UnmarshalEntry). Only the attributes tagged in the struct are requested.
+func (c *Conn) SearchObjects(filter string, v interface{}, sizeLimit int) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return errors.New("Decode error: v must be a non-nil pointer to a slice")
+	}
+
+	elemType := rv.Elem().Type().Elem()
+	structType := elemType
+	if structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return errors.New("Decode error: v must be a pointer to a slice of structs or struct pointers")
+	}
+
+	entries, err := c.Search(filter, attributesOf(structType), sizeLimit)
+	if err != nil {
+		return err
+	}
+
+	slice := reflect.MakeSlice(rv.Elem().Type(), len(entries), len(entries))
+	for idx, entry := range entries {
+		obj := reflect.New(structType)
+		if err = unmarshalStruct(entry, obj.Elem()); err != nil {
+			return fmt.Errorf("Decode error (%s): %w", entry.DN, err)
+		}
+		if elemType.Kind() == reflect.Ptr {
+			slice.Index(idx).Set(obj)
+		} else {
+			slice.Index(idx).Set(obj.Elem())
+		}
+	}
+	rv.Elem().Set(slice)
+
+	return nil
+}
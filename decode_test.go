@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+func TestUnmarshalEntry(t *testing.T) {
+	sidbin := []byte{1, 5, 0, 0, 0, 0, 0, 5, 0x15, 0, 0, 0, 0xe9, 0x67, 0xbb, 0x98, 0xd6, 0xb7, 0xd7, 0xbf, 0x82, 5, 0x1e, 0x6c, 0x28, 6, 0, 0}
+	guidbin := []byte{0xae, 0x4f, 0x1d, 0xf8, 0xec, 0x7d, 0xd0, 0x11, 0xa7, 0x65, 0x00, 0xa0, 0xc9, 0x1e, 0x6b, 0xf6}
+
+	entry := ldap.NewEntry("CN=John Doe,OU=Users,DC=example,DC=com", map[string][]string{
+		"objectGUID":         {string(guidbin)},
+		"objectSid":          {string(sidbin)},
+		"sAMAccountName":     {"jdoe"},
+		"memberOf":           {"CN=Group A,DC=example,DC=com", "CN=Group B,DC=example,DC=com"},
+		"primaryGroupID":     {"513"},
+		"userAccountControl": {"66048"},
+		"pwdLastSet":         {"133420185600000000"},
+		"accountExpires":     {"9223372036854775807"},
+		"whenCreated":        {"20231015123456.0Z"},
+	})
+
+	user := new(User)
+	if err := UnmarshalEntry(entry, user); err != nil {
+		t.Fatal("Expected err to be nil but got:", err)
+	}
+
+	if user.DN != entry.DN {
+		t.Errorf("Expected DN to be %s but got %s", entry.DN, user.DN)
+	}
+	if user.ObjectGUID.String() != "f81d4fae-7dec-11d0-a765-00a0c91e6bf6" {
+		t.Error("Expected GUID to be f81d4fae-7dec-11d0-a765-00a0c91e6bf6 but got", user.ObjectGUID.String())
+	}
+	if user.ObjectSID.String() != "S-1-5-21-2562418665-3218585558-1813906818-1576" {
+		t.Error("Expected SID to be S-1-5-21-2562418665-3218585558-1813906818-1576 but got", user.ObjectSID.String())
+	}
+	if user.SAMAccountName != "jdoe" {
+		t.Error("Expected sAMAccountName to be jdoe but got", user.SAMAccountName)
+	}
+	if len(user.MemberOf) != 2 || user.MemberOf[1] != "CN=Group B,DC=example,DC=com" {
+		t.Error("Expected 2 memberOf values but got", user.MemberOf)
+	}
+	if user.PrimaryGroupID != 513 {
+		t.Error("Expected primaryGroupID to be 513 but got", user.PrimaryGroupID)
+	}
+	if user.UserAccountControl != 66048 {
+		t.Error("Expected userAccountControl to be 66048 but got", user.UserAccountControl)
+	}
+	if !user.PwdLastSet.Equal(time.Date(2023, 10, 17, 12, 16, 0, 0, time.UTC)) {
+		t.Error("Expected pwdLastSet to be 2023-10-17 12:16:00 but got", user.PwdLastSet)
+	}
+	if !user.AccountExpires.IsZero() {
+		t.Error("Expected accountExpires to be zero but got", user.AccountExpires)
+	}
+	if !user.WhenCreated.Equal(time.Date(2023, 10, 15, 12, 34, 56, 0, time.UTC)) {
+		t.Error("Expected whenCreated to be 2023-10-15 12:34:56 but got", user.WhenCreated)
+	}
+	if user.Mail != "" {
+		t.Error("Expected missing mail to be empty but got", user.Mail)
+	}
+
+	var custom struct {
+		Enabled  bool        `ad:"isEnabled"`
+		Raw      []byte      `ad:"objectGUID"`
+		Raws     [][]byte    `ad:"memberOf"`
+		SIDs     []*SID      `ad:"tokenGroups"`
+		Optional *string     `ad:"mail"`
+		Present  *string     `ad:"sAMAccountName"`
+		Type     uint32      `ad:"groupType"`
+		Ignored  string      `ad:"-"`
+		Times    []time.Time `ad:"dSCorePropagationData"`
+		untagged string
+	}
+
+	entry = ldap.NewEntry("CN=Test,DC=example,DC=com", map[string][]string{
+		"isEnabled":             {"TRUE"},
+		"objectGUID":            {string(guidbin)},
+		"memberOf":              {"a", "b"},
+		"tokenGroups":           {string(sidbin), string(sidbin)},
+		"sAMAccountName":        {"test"},
+		"groupType":             {"-2147483646"},
+		"dSCorePropagationData": {"20231015123456.0Z", "16010101000000.0Z"},
+	})
+
+	if err := UnmarshalEntry(entry, &custom); err != nil {
+		t.Fatal("Custom: Expected err to be nil but got:", err)
+	}
+	if !custom.Enabled {
+		t.Error("Expected bool to be true")
+	}
+	if string(custom.Raw) != string(guidbin) {
+		t.Error("Expected raw value to be equal")
+	}
+	if len(custom.Raws) != 2 || len(custom.SIDs) != 2 || custom.SIDs[1].RID() != 1576 {
+		t.Error("Expected multiple values to be decoded")
+	}
+	if custom.Optional != nil {
+		t.Error("Expected missing pointer to be nil")
+	}
+	if custom.Present == nil || *custom.Present != "test" {
+		t.Error("Expected pointer to be set")
+	}
+	if custom.Type != 0x80000002 {
+		t.Errorf("Expected groupType to be %x but got %x", 0x80000002, custom.Type)
+	}
+	if len(custom.Times) != 2 {
+		t.Error("Expected 2 times but got", custom.Times)
+	}
+
+	errorTests := []interface{}{
+		nil,
+		custom,
+		new(string),
+		&struct {
+			Value int `ad:"sAMAccountName"`
+		}{},
+		&struct {
+			Value complex64 `ad:"sAMAccountName"`
+		}{},
+		&struct {
+			Value SID `ad:"sAMAccountName"`
+		}{},
+		&struct {
+			Value int `ad:"dn"`
+		}{},
+	}
+	for idx, test := range errorTests {
+		if err := UnmarshalEntry(entry, test); err == nil {
+			t.Errorf("Expected test %d to fail", idx)
+		}
+	}
+}
+
+func TestAttributesOf(t *testing.T) {
+	type embedded struct {
+		Mail string `ad:"mail"`
+	}
+	var v struct {
+		embedded
+		DN   string `ad:"dn"`
+		Name string `ad:"cn"`
+		Skip string `ad:"-"`
+		None string
+	}
+
+	attrs := attributesOf(reflect.TypeOf(v))
+	if len(attrs) != 2 || attrs[0] != "mail" || attrs[1] != "cn" {
+		t.Error("Expected attributes to be [mail cn] but got", attrs)
+	}
+}
+
+func TestConnGetObject(t *testing.T) {
+	if testConfig.Server == "" {
+		t.Skip("ADTEST_SERVER not set")
+		return
+	}
+
+	if testConfig.BindUPN == "" || testConfig.BindPass == "" {
+		t.Skip("ADTEST_BIND_UPN or ADTEST_BIND_PASS not set")
+		return
+	}
+
+	if testConfig.BaseDN == "" {
+		t.Skip("ADTEST_BASEDN not set")
+		return
+	}
+
+	config := &Config{Server: testConfig.Server, Port: testConfig.Port, Security: testConfig.BindSecurity, BaseDN: testConfig.BaseDN}
+	conn, err := config.Connect()
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Conn.Close()
+
+	status, err := conn.Bind(testConfig.BindUPN, testConfig.BindPass)
+	if err != nil {
+		t.Fatal("Error binding to server:", err)
+	}
+
+	if !status {
+		t.Fatal("Error binding to server: invalid credentials")
+	}
+
+	user := new(User)
+	if err = conn.GetObject("userPrincipalName", testConfig.BindUPN, user); err != nil {
+		t.Fatal("GetObject: Expected err to be nil but got:", err)
+	}
+	if user.UserPrincipalName != testConfig.BindUPN {
+		t.Errorf("GetObject: Expected userPrincipalName to be %s but got %s", testConfig.BindUPN, user.UserPrincipalName)
+	}
+	if user.ObjectSID.RID() == 0 || user.WhenCreated.IsZero() {
+		t.Error("GetObject: Expected objectSid and whenCreated to be set")
+	}
+
+	var groups []*Group
+	if err = conn.SearchObjects("(objectClass=group)", &groups, 0); err != nil {
+		t.Fatal("SearchObjects: Expected err to be nil but got:", err)
+	}
+	if len(groups) == 0 || groups[0].DN == "" {
+		t.Error("SearchObjects: Expected groups to be returned")
+	}
+
+	if err = conn.SearchObjects("(objectClass=group)", groups, 0); err == nil {
+		t.Error("SearchObjects: Expected non-pointer error but got nil")
+	}
+}
@@ -0,0 +1,317 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//digestMaxBuffer is the maxbuf assumed if the server doesn't send one (RFC 2831 section 2.1.1).
+const digestMaxBuffer = 65536
+
+//DigestMD5Bind authenticates the connection with SASL DIGEST-MD5 and returns the result or an error if one occurred.
+//username may be the sAMAccountName or the userPrincipalName; the realm is taken from the server's challenge.
+//If Config.DetailedErrors is set, invalid credentials are reported as a *BindError instead of false and a nil error.
+//On connections made with SecurityNone, integrity protection (LDAP signing) is negotiated for all traffic after the bind
+//if the server allows it, so the bind is accepted by domain controllers that require LDAP signing.
+//Traffic over TLS is already protected, so no SASL protection is added.
+func (c *Conn) DigestMD5Bind(username, password string) (bool, error) {
+	if password == "" {
+		return c.rejectEmptyPassword()
+	}
+
+	if c.sasl == nil {
+		err := c.bindAs(username, func() error {
+			return c.Conn.MD5Bind(c.host, username, password)
+		})
+		return c.bindResult(username, err)
+	}
+
+	if c.hasSecurityLayer() {
+		return false, fmt.Errorf("Bind error (%s): connection already has a SASL security layer", username)
+	}
+
+	var (
+		layer     *digestLayer
+		maxBuffer int
+	)
+	err := c.bindAs(username, func() error {
+		var err error
+		layer, maxBuffer, err = c.digestMD5Bind(username, password)
+		return err
+	})
+	if err == nil && layer != nil {
+		c.sasl.install(layer, maxBuffer)
+	}
+
+	return c.bindResult(username, err)
+}
+
+//DigestMD5BindContext is like DigestMD5Bind but the bind is aborted if ctx is done.
+func (c *Conn) DigestMD5BindContext(ctx context.Context, username, password string) (bool, error) {
+	return c.WithContext(ctx).DigestMD5Bind(username, password)
+}
+
+//digestMD5Bind performs the DIGEST-MD5 exchange on c.sasl and returns the negotiated security layer, or nil if none was
+//selected, and the largest buffer the server accepts.
+func (c *Conn) digestMD5Bind(username, password string) (*digestLayer, int, error) {
+	inProgress, cred, err := c.sasl.saslBind("DIGEST-MD5", nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !inProgress {
+		return nil, 0, errors.New("SASL error: server didn't send a DIGEST-MD5 challenge")
+	}
+
+	challenge, err := parseDigestChallenge(string(cred))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s, err := newDigestSession(challenge, username, password, "ldap/"+c.host)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	inProgress, cred, err = c.sasl.saslBind("DIGEST-MD5", s.encode())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	//Active Directory returns rspauth with the final result, but other servers expect an empty response to it first
+	rspauth := strings.TrimPrefix(string(cred), "rspauth=")
+	if subtle.ConstantTimeCompare([]byte(rspauth), []byte(s.response(false))) != 1 {
+		return nil, 0, errors.New("SASL error: server failed to authenticate (rspauth mismatch)")
+	}
+	if inProgress {
+		if inProgress, _, err = c.sasl.saslBind("DIGEST-MD5", []byte{}); err != nil {
+			return nil, 0, err
+		}
+		if inProgress {
+			return nil, 0, errors.New("SASL error: DIGEST-MD5 bind didn't complete")
+		}
+	}
+
+	if s.qop != "auth-int" {
+		return nil, 0, nil
+	}
+
+	maxBuffer := digestMaxBuffer
+	if v, ok := challenge["maxbuf"]; ok {
+		if maxBuffer, err = strconv.Atoi(v); err != nil || maxBuffer < 16 || maxBuffer > saslMaxBuffer {
+			return nil, 0, fmt.Errorf("SASL error: invalid maxbuf %q", v)
+		}
+	}
+
+	clientKey, serverKey := s.keys()
+	return &digestLayer{sendKey: clientKey, recvKey: serverKey}, maxBuffer, nil
+}
+
+//parseDigestChallenge parses the comma-separated directives of a DIGEST-MD5 challenge or response (RFC 2831 section 7.1).
+//If a directive is repeated, e.g. realm, the first value is kept.
+func parseDigestChallenge(challenge string) (map[string]string, error) {
+	directives := make(map[string]string)
+
+	for s := strings.TrimSpace(challenge); s != ""; {
+		idx := strings.IndexByte(s, '=')
+		if idx <= 0 {
+			return nil, fmt.Errorf("SASL error: invalid DIGEST-MD5 directive %q", s)
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:idx]))
+		s = strings.TrimLeft(s[idx+1:], " \t")
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, fmt.Errorf("SASL error: unterminated DIGEST-MD5 directive %q", key)
+			}
+			value, s = b.String(), s[i+1:]
+		} else {
+			idx = strings.IndexByte(s, ',')
+			if idx < 0 {
+				idx = len(s)
+			}
+			value, s = strings.TrimSpace(s[:idx]), s[idx:]
+		}
+
+		if _, ok := directives[key]; !ok {
+			directives[key] = value
+		}
+
+		s = strings.TrimSpace(s)
+		if s != "" && s[0] != ',' {
+			return nil, fmt.Errorf("SASL error: invalid DIGEST-MD5 directive %q", key)
+		}
+		s = strings.TrimLeft(s, ", \t")
+	}
+
+	return directives, nil
+}
+
+//digestSession holds the values a DIGEST-MD5 response is computed from (RFC 2831 section 2.1.2).
+type digestSession struct {
+	username, realm, password string
+	nonce, cnonce, uri, qop   string
+	utf8                      bool
+}
+
+//newDigestSession returns a digestSession answering challenge with the given credentials and digest-uri.
+//auth-int is chosen if the server offers it; confidentiality (auth-conf) isn't supported.
+func newDigestSession(challenge map[string]string, username, password, uri string) (*digestSession, error) {
+	if algorithm := challenge["algorithm"]; algorithm != "md5-sess" {
+		return nil, fmt.Errorf("SASL error: unsupported DIGEST-MD5 algorithm %q", algorithm)
+	}
+
+	nonce := challenge["nonce"]
+	if nonce == "" {
+		return nil, errors.New("SASL error: DIGEST-MD5 challenge has no nonce")
+	}
+
+	offered := saslLayerNone
+	if qop, ok := challenge["qop"]; ok {
+		offered = 0
+		for _, v := range strings.Split(qop, ",") {
+			switch strings.TrimSpace(v) {
+			case "auth":
+				offered |= saslLayerNone
+			case "auth-int":
+				offered |= saslLayerIntegrity
+			}
+		}
+	}
+
+	layer, err := chooseLayer(ProtectionAuto, offered, true)
+	if err != nil {
+		return nil, fmt.Errorf("SASL error: %w", err)
+	}
+	qop := "auth"
+	if layer == saslLayerIntegrity {
+		qop = "auth-int"
+	}
+
+	cnonce := make([]byte, 16)
+	if _, err = rand.Read(cnonce); err != nil {
+		return nil, err
+	}
+
+	return &digestSession{
+		username: username,
+		realm:    challenge["realm"],
+		password: password,
+		nonce:    nonce,
+		cnonce:   hex.EncodeToString(cnonce),
+		uri:      uri,
+		qop:      qop,
+		utf8:     challenge["charset"] == "utf-8",
+	}, nil
+}
+
+//ha1 returns H(A1), which the response and the integrity keys are derived from.
+func (s *digestSession) ha1() []byte {
+	secret := md5.Sum([]byte(s.username + ":" + s.realm + ":" + s.password))
+	a1 := append(secret[:], ":"+s.nonce+":"+s.cnonce...)
+	sum := md5.Sum(a1)
+	return sum[:]
+}
+
+//response returns the response directive sent to the server, or, if initiator is false, the rspauth expected from it.
+func (s *digestSession) response(initiator bool) string {
+	a2 := ":" + s.uri
+	if initiator {
+		a2 = "AUTHENTICATE" + a2
+	}
+	if s.qop != "auth" {
+		a2 += ":00000000000000000000000000000000"
+	}
+	ha2 := md5.Sum([]byte(a2))
+
+	kd := fmt.Sprintf("%x:%s:00000001:%s:%s:%x", s.ha1(), s.nonce, s.cnonce, s.qop, ha2)
+	return fmt.Sprintf("%x", md5.Sum([]byte(kd)))
+}
+
+//keys returns the integrity keys for messages sent by the client and by the server (RFC 2831 section 2.3).
+func (s *digestSession) keys() (client, server []byte) {
+	ha1 := s.ha1()
+	kic := md5.Sum(append(ha1, "Digest session key to client-to-server signing key magic constant"...))
+	kis := md5.Sum(append(ha1, "Digest session key to server-to-client signing key magic constant"...))
+	return kic[:], kis[:]
+}
+
+//encode returns the digest-response sent to the server.
+func (s *digestSession) encode() []byte {
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+	var b strings.Builder
+	if s.utf8 {
+		b.WriteString("charset=utf-8,")
+	}
+	fmt.Fprintf(&b, `username="%s",realm="%s",nonce="%s",cnonce="%s",nc=00000001,qop=%s,digest-uri="%s",response=%s`,
+		quote.Replace(s.username), quote.Replace(s.realm), quote.Replace(s.nonce), s.cnonce, s.qop, quote.Replace(s.uri), s.response(true))
+	if s.qop == "auth-int" {
+		fmt.Fprintf(&b, ",maxbuf=%d", saslMaxBuffer)
+	}
+
+	return []byte(b.String())
+}
+
+//digestLayer is the DIGEST-MD5 integrity layer (RFC 2831 section 2.3).
+type digestLayer struct {
+	sendKey, recvKey []byte
+	sendSeq, recvSeq uint32
+}
+
+//mac returns the MAC of msg with sequence number seq.
+func (l *digestLayer) mac(key []byte, seq uint32, msg []byte) []byte {
+	h := hmac.New(md5.New, key)
+	binary.Write(h, binary.BigEndian, seq)
+	h.Write(msg)
+	return h.Sum(nil)[:10]
+}
+
+func (l *digestLayer) Wrap(p []byte) ([]byte, error) {
+	n := len(p)
+	token := make([]byte, n+16)
+	copy(token, p)
+	copy(token[n:], l.mac(l.sendKey, l.sendSeq, p))
+	token[n+11] = 1
+	binary.BigEndian.PutUint32(token[n+12:], l.sendSeq)
+	l.sendSeq++
+	return token, nil
+}
+
+func (l *digestLayer) Unwrap(token []byte) ([]byte, error) {
+	if len(token) < 16 {
+		return nil, errors.New("DIGEST-MD5 token too short")
+	}
+
+	n := len(token) - 16
+	msg, mac, version, seq := token[:n], token[n:n+10], token[n+10:n+12], binary.BigEndian.Uint32(token[n+12:])
+	if version[0] != 0 || version[1] != 1 {
+		return nil, errors.New("invalid DIGEST-MD5 token version")
+	}
+	if seq != l.recvSeq {
+		return nil, fmt.Errorf("unexpected DIGEST-MD5 sequence number %d (expected %d)", seq, l.recvSeq)
+	}
+	if !hmac.Equal(mac, l.mac(l.recvKey, seq, msg)) {
+		return nil, errors.New("DIGEST-MD5 token integrity check failed")
+	}
+
+	l.recvSeq++
+	return msg, nil
+}
@@ -0,0 +1,265 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+func TestDigestSession(t *testing.T) {
+	//example from RFC 2831 section 4
+	s := &digestSession{
+		username: "chris",
+		realm:    "elwood.innosoft.com",
+		password: "secret",
+		nonce:    "OA6MG9tEQGm2hh",
+		cnonce:   "OA6MHXh6VqTrRk",
+		uri:      "imap/elwood.innosoft.com",
+		qop:      "auth",
+	}
+
+	if response := s.response(true); response != "d388dad90d4bbd760a152321f2143af7" {
+		t.Errorf("response: Expected %s but got: %s", "d388dad90d4bbd760a152321f2143af7", response)
+	}
+	if rspauth := s.response(false); rspauth != "ea40f60335c427b5527b84dbabcdfffd" {
+		t.Errorf("rspauth: Expected %s but got: %s", "ea40f60335c427b5527b84dbabcdfffd", rspauth)
+	}
+
+	directives, err := parseDigestChallenge(string(s.encode()))
+	if err != nil {
+		t.Fatal("encode: Expected err to be nil but got:", err)
+	}
+	for key, value := range map[string]string{"username": "chris", "realm": "elwood.innosoft.com", "qop": "auth", "nc": "00000001", "response": "d388dad90d4bbd760a152321f2143af7"} {
+		if directives[key] != value {
+			t.Errorf("encode: Expected %s=%q but got: %q", key, value, directives[key])
+		}
+	}
+	if _, ok := directives["maxbuf"]; ok {
+		t.Error("encode: Expected no maxbuf without a security layer")
+	}
+}
+
+func TestParseDigestChallenge(t *testing.T) {
+	type test struct {
+		challenge  string
+		directives map[string]string
+	}
+
+	tests := []test{
+		{`realm="elwood.innosoft.com",nonce="OA6MG9tEQGm2hh",qop="auth",algorithm=md5-sess,charset=utf-8`,
+			map[string]string{"realm": "elwood.innosoft.com", "nonce": "OA6MG9tEQGm2hh", "qop": "auth", "algorithm": "md5-sess", "charset": "utf-8"}},
+		{`qop="auth,auth-int,auth-conf", cipher="3des,rc4", maxbuf=65536, realm="a", realm="b"`,
+			map[string]string{"qop": "auth,auth-int,auth-conf", "cipher": "3des,rc4", "maxbuf": "65536", "realm": "a"}},
+		{`Realm="CORP \"main\"",nonce="a\\b"`, map[string]string{"realm": `CORP "main"`, "nonce": `a\b`}},
+	}
+
+	for _, test := range tests {
+		directives, err := parseDigestChallenge(test.challenge)
+		if err != nil {
+			t.Errorf("Expected err to be nil for %q but got: %v", test.challenge, err)
+			continue
+		}
+		if len(directives) != len(test.directives) {
+			t.Errorf("Expected %v for %q but got: %v", test.directives, test.challenge, directives)
+			continue
+		}
+		for key, value := range test.directives {
+			if directives[key] != value {
+				t.Errorf("Expected %s=%q for %q but got: %q", key, value, test.challenge, directives[key])
+			}
+		}
+	}
+
+	for _, challenge := range []string{`nonce`, `nonce="abc`, `nonce="abc"realm="x"`} {
+		if _, err := parseDigestChallenge(challenge); err == nil {
+			t.Errorf("Expected error for %q but got nil", challenge)
+		}
+	}
+}
+
+func TestDigestLayer(t *testing.T) {
+	s := &digestSession{username: "jdoe", realm: "example.com", password: "secret", nonce: "n", cnonce: "c", uri: "ldap/dc1", qop: "auth-int"}
+	kic, kis := s.keys()
+	if bytes.Equal(kic, kis) {
+		t.Fatal("keys: Expected client and server keys to differ")
+	}
+
+	client := &digestLayer{sendKey: kic, recvKey: kis}
+	server := &digestLayer{sendKey: kis, recvKey: kic}
+
+	for _, msg := range []string{"first", "second", ""} {
+		token, err := client.Wrap([]byte(msg))
+		if err != nil {
+			t.Fatal("Wrap: Expected err to be nil but got:", err)
+		}
+		p, err := server.Unwrap(token)
+		if err != nil || string(p) != msg {
+			t.Errorf("Unwrap: Expected %q but got: %q, %v", msg, p, err)
+		}
+	}
+
+	token, _ := server.Wrap([]byte("reply"))
+	if _, err := server.Unwrap(token); err == nil {
+		t.Error("Unwrap: Expected error for token sent in the wrong direction")
+	}
+
+	tampered, _ := client.Wrap([]byte("tampered"))
+	tampered[0] ^= 1
+	if _, err := server.Unwrap(tampered); err == nil {
+		t.Error("Unwrap: Expected error for tampered token")
+	}
+
+	//the server's sequence number didn't advance, so the next token is out of order
+	token, _ = client.Wrap([]byte("replayed"))
+	if _, err := server.Unwrap(token); err == nil {
+		t.Error("Unwrap: Expected error for out of order token")
+	}
+}
+
+//serveDigest answers requests on conn like a server that supports DIGEST-MD5 with the given qop values until it's closed.
+//After an auth-int bind, requests and responses are protected by the integrity layer.
+func serveDigest(conn net.Conn, username, password, qop string) {
+	defer conn.Close()
+
+	var (
+		nonce = "OA6MG9tEQGm2hh"
+		layer *digestLayer
+	)
+
+	for {
+		var (
+			packet *ber.Packet
+			err    error
+		)
+		if layer == nil {
+			packet, err = ber.ReadPacket(conn)
+		} else {
+			var size [4]byte
+			if _, err = io.ReadFull(conn, size[:]); err != nil {
+				return
+			}
+			token := make([]byte, binary.BigEndian.Uint32(size[:]))
+			if _, err = io.ReadFull(conn, token); err != nil {
+				return
+			}
+			var msg []byte
+			if msg, err = layer.Unwrap(token); err != nil {
+				return
+			}
+			packet, err = ber.DecodePacketErr(msg)
+		}
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+
+		var (
+			resp    *ber.Packet
+			install *digestLayer
+		)
+		switch req := packet.Children[1]; req.Tag {
+		case ldap.ApplicationBindRequest:
+			auth := req.Children[2]
+			if len(auth.Children) < 2 {
+				challenge := `realm="example.com",nonce="` + nonce + `",qop="` + qop + `",charset=utf-8,algorithm=md5-sess,maxbuf=1024`
+				resp = ldapResponse(id, ldap.ApplicationBindResponse, ldap.LDAPResultSaslBindInProgress,
+					ber.NewString(ber.ClassContext, ber.TypePrimitive, 7, challenge, ""))
+				break
+			}
+
+			directives, err := parseDigestChallenge(auth.Children[1].Data.String())
+			if err != nil {
+				return
+			}
+			s := &digestSession{username: directives["username"], realm: directives["realm"], password: password,
+				nonce: nonce, cnonce: directives["cnonce"], uri: directives["digest-uri"], qop: directives["qop"]}
+			if s.username != username || directives["response"] != s.response(true) {
+				resp = ldapResponse(id, ldap.ApplicationBindResponse, ldap.LDAPResultInvalidCredentials)
+				break
+			}
+
+			resp = ldapResponse(id, ldap.ApplicationBindResponse, ldap.LDAPResultSuccess,
+				ber.NewString(ber.ClassContext, ber.TypePrimitive, 7, "rspauth="+s.response(false), ""))
+			if s.qop == "auth-int" {
+				kic, kis := s.keys()
+				install = &digestLayer{sendKey: kis, recvKey: kic}
+			}
+		case ldap.ApplicationExtendedRequest:
+			resp = ldapResponse(id, ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess,
+				ber.NewString(ber.ClassContext, ber.TypePrimitive, 11, "u:CORP\\"+username, ""))
+		default:
+			return
+		}
+
+		out := resp.Bytes()
+		if layer != nil {
+			token, _ := layer.Wrap(out)
+			out = make([]byte, 4+len(token))
+			binary.BigEndian.PutUint32(out, uint32(len(token)))
+			copy(out[4:], token)
+		}
+		if _, err = conn.Write(out); err != nil {
+			return
+		}
+
+		if install != nil {
+			layer = install
+		}
+	}
+}
+
+func TestConnDigestMD5Bind(t *testing.T) {
+	type test struct {
+		qop      string
+		password string
+		status   bool
+		layer    bool
+	}
+
+	tests := []test{
+		{"auth,auth-int", "secret", true, true},
+		{"auth", "secret", true, false},
+		{"auth,auth-int", "invalid password", false, false},
+	}
+
+	for _, test := range tests {
+		client, server := net.Pipe()
+		go serveDigest(server, "jdoe", "secret", test.qop)
+
+		sasl := newSASLConn(client)
+		ldapConn := ldap.NewConn(sasl, false)
+		ldapConn.Start()
+		conn := &Conn{Conn: ldapConn, Config: &Config{}, bound: new(bindState), host: "dc1.example.com", sasl: sasl}
+
+		status, err := conn.DigestMD5Bind("jdoe", test.password)
+		if err != nil {
+			t.Errorf("%s: Expected err to be nil but got: %v", test.qop, err)
+		}
+		if status != test.status {
+			t.Errorf("%s: Expected status %v but got: %v", test.qop, test.status, status)
+		}
+		if conn.hasSecurityLayer() != test.layer {
+			t.Errorf("%s: Expected security layer %v but got: %v", test.qop, test.layer, conn.hasSecurityLayer())
+		}
+
+		if status {
+			result, err := conn.Conn.WhoAmI(nil)
+			if err != nil {
+				t.Errorf("%s: Expected WhoAmI err to be nil but got: %v", test.qop, err)
+			} else if result.AuthzID != `u:CORP\jdoe` {
+				t.Errorf("%s: Expected WhoAmI %q but got: %q", test.qop, `u:CORP\jdoe`, result.AuthzID)
+			}
+
+			if _, err = conn.DigestMD5Bind("jdoe", "secret"); test.layer && err == nil {
+				t.Errorf("%s: Expected error binding again with a security layer", test.qop)
+			}
+		}
+
+		conn.Conn.Close()
+	}
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Resolver looks up DNS SRV records. *net.Resolver implements Resolver.
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error)
+}
+
+//NewConfigFromDomain returns a Config for the given DNS domain, e.g. "example.com",
+//with BaseDN derived from domain and servers discovered with DiscoverServers, or an error if one occurred.
+//site and resolver are stored in Config.Site and Config.Resolver before discovering and may be empty or nil.
+//Port is left unset, so the ports from the SRV records are used.
+func NewConfigFromDomain(domain, site string, resolver Resolver) (*Config, error) {
+	return NewConfigFromDomainContext(context.Background(), domain, site, resolver)
+}
+
+//NewConfigFromDomainContext is like NewConfigFromDomain but the DNS lookups are aborted if ctx is done.
+func NewConfigFromDomainContext(ctx context.Context, domain, site string, resolver Resolver) (*Config, error) {
+	var parts []string
+	for _, label := range strings.Split(strings.Trim(domain, "."), ".") {
+		if label == "" {
+			return nil, fmt.Errorf(`Configuration error: invalid domain "%s"`, domain)
+		}
+		parts = append(parts, "DC="+label)
+	}
+
+	c := &Config{BaseDN: strings.Join(parts, ","), Site: site, Resolver: resolver}
+	if err := c.DiscoverServersContext(ctx); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+//DiscoverServers sets Servers to the domain controllers found in the _ldap._tcp SRV records for the domain derived from BaseDN
+//or returns an error if one occurred. If Site is set, domain controllers in that site are listed first.
+//Records are ordered by priority and weight, so Selection should be SelectInOrder to honor them.
+//If Port is set, only hostnames are stored and Port is used to connect; otherwise the port from the SRV record is used.
+func (c *Config) DiscoverServers() error {
+	return c.DiscoverServersContext(context.Background())
+}
+
+//DiscoverServersContext is like DiscoverServers but the DNS lookups are aborted if ctx is done.
+func (c *Config) DiscoverServersContext(ctx context.Context) error {
+	domain, err := c.Domain()
+	if err != nil {
+		return err
+	}
+
+	var resolver Resolver = net.DefaultResolver
+	if c.Resolver != nil {
+		resolver = c.Resolver
+	}
+
+	var records []*net.SRV
+	if c.Site != "" {
+		//a missing site isn't fatal since the domain-wide records are still available
+		if _, addrs, err := resolver.LookupSRV(ctx, "ldap", "tcp", fmt.Sprintf("%s._sites.dc._msdcs.%s", c.Site, domain)); err == nil {
+			records = append(records, orderSRV(addrs)...)
+		}
+	}
+
+	_, addrs, err := resolver.LookupSRV(ctx, "ldap", "tcp", domain)
+	if err != nil && len(records) == 0 {
+		return fmt.Errorf("Discovery error: %w", err)
+	}
+	records = append(records, orderSRV(addrs)...)
+
+	seen := make(map[string]struct{})
+	var servers []string
+	for _, r := range records {
+		host := strings.TrimSuffix(r.Target, ".")
+		if host == "" {
+			continue
+		}
+		if c.Port == 0 {
+			host = net.JoinHostPort(host, strconv.Itoa(int(r.Port)))
+		}
+		if _, ok := seen[host]; ok {
+			continue
+		}
+		seen[host] = struct{}{}
+		servers = append(servers, host)
+	}
+
+	if len(servers) == 0 {
+		return errors.New("Discovery error: no servers found")
+	}
+
+	c.Servers = servers
+	return nil
+}
+
+//orderSRV orders records by priority and then randomly by weight, as described in RFC 2782.
+func orderSRV(addrs []*net.SRV) []*net.SRV {
+	sorted := make([]*net.SRV, len(addrs))
+	copy(sorted, addrs)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Priority < sorted[j].Priority })
+
+	ordered := make([]*net.SRV, 0, len(sorted))
+	for start := 0; start < len(sorted); {
+		end := start
+		for end < len(sorted) && sorted[end].Priority == sorted[start].Priority {
+			end++
+		}
+
+		group := sorted[start:end]
+		for len(group) > 0 {
+			total := 0
+			for _, r := range group {
+				total += int(r.Weight)
+			}
+
+			idx := 0
+			if total > 0 {
+				n := rand.Intn(total)
+				for i, r := range group {
+					if n -= int(r.Weight); n < 0 {
+						idx = i
+						break
+					}
+				}
+			}
+
+			ordered = append(ordered, group[idx])
+			group = append(group[:idx:idx], group[idx+1:]...)
+		}
+
+		start = end
+	}
+
+	return ordered
+}
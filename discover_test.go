@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+type testResolver map[string][]*net.SRV
+
+func (r testResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	cname := fmt.Sprintf("_%s._%s.%s", service, proto, name)
+	addrs, ok := r[cname]
+	if !ok {
+		return "", nil, &net.DNSError{Err: "no such host", Name: cname, IsNotFound: true}
+	}
+	return cname, addrs, nil
+}
+
+func TestConfigDiscoverServers(t *testing.T) {
+	resolver := testResolver{
+		"_ldap._tcp.example.com": {
+			{Target: "dc3.example.com.", Port: 389, Priority: 10, Weight: 100},
+			{Target: "dc1.example.com.", Port: 389, Priority: 0, Weight: 0},
+			{Target: "dc2.example.com.", Port: 389, Priority: 5, Weight: 100},
+		},
+		"_ldap._tcp.hq._sites.dc._msdcs.example.com": {
+			{Target: "dc2.example.com.", Port: 389, Priority: 0, Weight: 100},
+		},
+	}
+
+	config := &Config{Port: 636, BaseDN: "DC=example,DC=com", Resolver: resolver}
+	if err := config.DiscoverServers(); err != nil {
+		t.Fatal("Expected err to be nil but got:", err)
+	}
+	expected := []string{"dc1.example.com", "dc2.example.com", "dc3.example.com"}
+	if fmt.Sprint(config.Servers) != fmt.Sprint(expected) {
+		t.Errorf("Expected servers to be %v but got %v", expected, config.Servers)
+	}
+
+	config = &Config{BaseDN: "DC=example,DC=com", Site: "hq", Resolver: resolver}
+	if err := config.DiscoverServers(); err != nil {
+		t.Fatal("Site: Expected err to be nil but got:", err)
+	}
+	expected = []string{"dc2.example.com:389", "dc1.example.com:389", "dc3.example.com:389"}
+	if fmt.Sprint(config.Servers) != fmt.Sprint(expected) {
+		t.Errorf("Site: Expected servers to be %v but got %v", expected, config.Servers)
+	}
+
+	config = &Config{BaseDN: "DC=example,DC=com", Site: "missing", Resolver: resolver}
+	if err := config.DiscoverServers(); err != nil {
+		t.Error("Missing site: Expected err to be nil but got:", err)
+	}
+
+	config = &Config{BaseDN: "DC=example,DC=org", Resolver: resolver}
+	var dnsErr *net.DNSError
+	if err := config.DiscoverServers(); !errors.As(err, &dnsErr) {
+		t.Error("Missing domain: Expected DNS error but got:", err)
+	}
+
+	if err := (&Config{BaseDN: "Bad BaseDN", Resolver: resolver}).DiscoverServers(); err == nil {
+		t.Error("Invalid configuration: Expected configuration error but got nil")
+	}
+}
+
+func TestOrderSRV(t *testing.T) {
+	addrs := []*net.SRV{
+		{Target: "c", Priority: 2, Weight: 10},
+		{Target: "a1", Priority: 1, Weight: 10},
+		{Target: "b", Priority: 2, Weight: 0},
+		{Target: "a2", Priority: 1, Weight: 90},
+	}
+
+	for i := 0; i < 20; i++ {
+		ordered := orderSRV(addrs)
+		if len(ordered) != len(addrs) {
+			t.Fatalf("Expected %d records but got %d", len(addrs), len(ordered))
+		}
+		if ordered[0].Priority != 1 || ordered[1].Priority != 1 {
+			t.Fatal("Expected lowest priority records to be first")
+		}
+		if ordered[2].Target != "c" || ordered[3].Target != "b" {
+			t.Fatal("Expected weighted record before zero weight record")
+		}
+	}
+}
+
+func TestNewConfigFromDomain(t *testing.T) {
+	if _, err := NewConfigFromDomain("example..com", "", nil); err == nil {
+		t.Error("Invalid domain: Expected configuration error but got nil")
+	}
+
+	resolver := testResolver{
+		"_ldap._tcp.example.com": {
+			{Target: "dc1.example.com.", Port: 389, Priority: 0, Weight: 0},
+			{Target: "dc2.example.com.", Port: 3268, Priority: 5, Weight: 0},
+		},
+		"_ldap._tcp.hq._sites.dc._msdcs.example.com": {
+			{Target: "dc2.example.com.", Port: 3268, Priority: 0, Weight: 0},
+		},
+	}
+
+	config, err := NewConfigFromDomain("example.com", "hq", resolver)
+	if err != nil {
+		t.Fatal("Expected err to be nil but got:", err)
+	}
+	if config.BaseDN != "DC=example,DC=com" || config.Site != "hq" || config.Port != 0 {
+		t.Errorf("Expected BaseDN, Site and Port to be set from arguments but got: %q, %q, %d", config.BaseDN, config.Site, config.Port)
+	}
+	expected := []string{"dc2.example.com:3268", "dc1.example.com:389"}
+	if fmt.Sprint(config.Servers) != fmt.Sprint(expected) {
+		t.Errorf("Expected servers to be %v but got %v", expected, config.Servers)
+	}
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+//Active Directory bind failure sub-codes, found in the diagnostic message as "data <code>".
+//See https://ldapwiki.com/wiki/Wiki.jsp?page=Common%20Active%20Directory%20Bind%20Errors
+const (
+	ADCodeUserNotFound       = 0x525
+	ADCodeInvalidCredentials = 0x52e
+	ADCodeInvalidLogonHours  = 0x530
+	ADCodeInvalidWorkstation = 0x531
+	ADCodePasswordExpired    = 0x532
+	ADCodeAccountDisabled    = 0x533
+	ADCodeAccountExpired     = 0x701
+	ADCodePasswordMustChange = 0x773
+	ADCodeAccountLocked      = 0x775
+)
+
+//Reasons a bind failed. Use errors.Is to check a *BindError against them.
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInvalidLogonHours  = errors.New("logon not permitted at this time")
+	ErrInvalidWorkstation = errors.New("logon not permitted from this workstation")
+	ErrPasswordExpired    = errors.New("password expired")
+	ErrAccountDisabled    = errors.New("account disabled")
+	ErrAccountExpired     = errors.New("account expired")
+	ErrPasswordMustChange = errors.New("password must be changed")
+	ErrAccountLocked      = errors.New("account locked")
+)
+
+var bindReasons = map[uint32]error{
+	ADCodeUserNotFound:       ErrUserNotFound,
+	ADCodeInvalidCredentials: ErrInvalidCredentials,
+	ADCodeInvalidLogonHours:  ErrInvalidLogonHours,
+	ADCodeInvalidWorkstation: ErrInvalidWorkstation,
+	ADCodePasswordExpired:    ErrPasswordExpired,
+	ADCodeAccountDisabled:    ErrAccountDisabled,
+	ADCodeAccountExpired:     ErrAccountExpired,
+	ADCodePasswordMustChange: ErrPasswordMustChange,
+	ADCodeAccountLocked:      ErrAccountLocked,
+}
+
+//BindError is returned when Config.DetailedErrors is set and the server rejects the given credentials.
+//Reason is one of the Err* reasons above, so callers can use errors.Is, e.g. errors.Is(err, ErrAccountLocked).
+type BindError struct {
+	//Code is the Active Directory sub-code parsed from the diagnostic message, e.g. ADCodeAccountLocked,
+	//or 0 if the server didn't send one.
+	Code uint32
+	//Reason is the reason the bind failed. Unknown codes are reported as ErrInvalidCredentials.
+	Reason error
+	//Err is the LDAP error returned by the server, or nil if the bind wasn't attempted, e.g. for an empty password.
+	Err *ldap.Error
+}
+
+func (e *BindError) Error() string {
+	if e.Code == 0 {
+		return fmt.Sprintf("Bind error: %v", e.Reason)
+	}
+	return fmt.Sprintf("Bind error: %v (data %x)", e.Reason, e.Code)
+}
+
+//Unwrap returns e.Reason.
+func (e *BindError) Unwrap() error {
+	return e.Reason
+}
+
+//rejected returns the error to return for credentials rejected for the given reason:
+//a *BindError if DetailedErrors is set, or nil otherwise.
+func (c *Config) rejected(reason error) error {
+	if c.DetailedErrors {
+		return &BindError{Reason: reason}
+	}
+	return nil
+}
+
+var bindDataRegexp = regexp.MustCompile(`data ([0-9a-fA-F]+)`)
+
+//newBindError returns a *BindError for an invalid credentials error returned by the server.
+func newBindError(err *ldap.Error) *BindError {
+	e := &BindError{Reason: ErrInvalidCredentials, Err: err}
+
+	if err.Err == nil {
+		return e
+	}
+
+	if m := bindDataRegexp.FindStringSubmatch(err.Err.Error()); m != nil {
+		if code, perr := strconv.ParseUint(m[1], 16, 32); perr == nil {
+			e.Code = uint32(code)
+			if reason, ok := bindReasons[e.Code]; ok {
+				e.Reason = reason
+			}
+		}
+	}
+
+	return e
+}
+
+//Active Directory error codes found at the start of the diagnostic message of a failed operation, e.g. "00000562: UpdErr: ...".
+//These are Windows system error codes.
+const (
+	ADCodeAccessDenied        = 0x5
+	ADCodeGenFailure          = 0x1f
+	ADCodeInvalidPassword     = 0x56
+	ADCodePasswordRestriction = 0x52d
+	ADCodeNotMember           = 0x561
+	ADCodeAlreadyMember       = 0x562
+)
+
+//Reasons an operation failed. Use errors.Is to check a *ModifyError against them.
+var (
+	ErrInsufficientRights = errors.New("insufficient access rights")
+	ErrNotMember          = errors.New("not a member of the group")
+	ErrAlreadyMember      = errors.New("already a member of the group")
+)
+
+//Reasons a password change failed. Use errors.Is to check an error returned by UpdatePassword or ModifyDNPassword against them.
+//ErrInsufficientRights is returned if the bound user isn't allowed to reset the password.
+var (
+	ErrWrongPassword = errors.New("old password is incorrect")
+	//ErrPasswordRestriction is returned if the new password doesn't meet the length, complexity or history requirements
+	//of the password policy. See PasswordPolicy.Validate.
+	ErrPasswordRestriction = errors.New("password does not meet the password policy requirements")
+	ErrPasswordTooYoung    = errors.New("password was changed too recently")
+	//ErrEncryptionRequired is returned if the connection isn't encrypted. Passwords can only be changed over TLS or StartTLS.
+	ErrEncryptionRequired = errors.New("encrypted connection required")
+)
+
+var modifyReasons = map[uint32]error{
+	ADCodeAccessDenied:  ErrInsufficientRights,
+	ADCodeNotMember:     ErrNotMember,
+	ADCodeAlreadyMember: ErrAlreadyMember,
+}
+
+var passwordReasons = map[uint32]error{
+	ADCodeAccessDenied:        ErrInsufficientRights,
+	ADCodeInvalidPassword:     ErrWrongPassword,
+	ADCodePasswordRestriction: ErrPasswordRestriction,
+}
+
+//ModifyError is returned when the server rejects an add, modify, delete or rename operation.
+//If the Active Directory error code is known, Reason is one of the Err* reasons above, so callers can use errors.Is,
+//e.g. errors.Is(err, ErrAlreadyMember).
+type ModifyError struct {
+	//Code is the Active Directory error code parsed from the diagnostic message, e.g. ADCodeAlreadyMember,
+	//or 0 if the server didn't send one.
+	Code uint32
+	//Reason is the reason the operation failed, or nil if the code is unknown.
+	Reason error
+	//Err is the LDAP error returned by the server.
+	Err *ldap.Error
+}
+
+func (e *ModifyError) Error() string {
+	if e.Reason == nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v (%x): %v", e.Reason, e.Code, e.Err)
+}
+
+//Unwrap returns e.Reason, or e.Err if the reason is unknown.
+func (e *ModifyError) Unwrap() error {
+	if e.Reason == nil {
+		return e.Err
+	}
+	return e.Reason
+}
+
+var modifyCodeRegexp = regexp.MustCompile(`^([0-9a-fA-F]{8}): `)
+
+//newModifyError returns a *ModifyError for an error returned by the server, or err unchanged if it isn't an *ldap.Error.
+func newModifyError(err error) error {
+	lerr, ok := err.(*ldap.Error)
+	if !ok {
+		return err
+	}
+
+	e := &ModifyError{Err: lerr}
+	if lerr.Err == nil {
+		return e
+	}
+
+	if m := modifyCodeRegexp.FindStringSubmatch(lerr.Err.Error()); m != nil {
+		if code, perr := strconv.ParseUint(m[1], 16, 32); perr == nil {
+			e.Code = uint32(code)
+			e.Reason = modifyReasons[e.Code]
+		}
+	}
+
+	return e
+}
+
+//newPasswordError is like newModifyError, but for errors returned when changing unicodePwd.
+//encrypted is true if the connection uses TLS. Active Directory reports a missing encrypted connection only with the
+//generic ADCodeGenFailure, so it's only mapped to ErrEncryptionRequired for unencrypted connections.
+func newPasswordError(err error, encrypted bool) error {
+	e, ok := newModifyError(err).(*ModifyError)
+	if !ok {
+		return err
+	}
+
+	if reason, ok := passwordReasons[e.Code]; ok {
+		e.Reason = reason
+	} else if e.Code == ADCodeGenFailure && e.Err.ResultCode == ldap.LDAPResultUnwillingToPerform && !encrypted {
+		e.Reason = ErrEncryptionRequired
+	} else if e.Err.ResultCode == ldap.LDAPResultInsufficientAccessRights {
+		e.Reason = ErrInsufficientRights
+	}
+
+	return e
+}
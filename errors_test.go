@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+func TestBindError(t *testing.T) {
+	tests := map[string]error{
+		"80090308: LdapErr: DSID-0C09042A, comment: AcceptSecurityContext error, data 52e, v3839": ErrInvalidCredentials,
+		"80090308: LdapErr: DSID-0C09042A, comment: AcceptSecurityContext error, data 525, v3839": ErrUserNotFound,
+		"80090308: LdapErr: DSID-0C09042A, comment: AcceptSecurityContext error, data 530, v3839": ErrInvalidLogonHours,
+		"80090308: LdapErr: DSID-0C09042A, comment: AcceptSecurityContext error, data 531, v3839": ErrInvalidWorkstation,
+		"80090308: LdapErr: DSID-0C09042A, comment: AcceptSecurityContext error, data 532, v3839": ErrPasswordExpired,
+		"80090308: LdapErr: DSID-0C09042A, comment: AcceptSecurityContext error, data 533, v3839": ErrAccountDisabled,
+		"80090308: LdapErr: DSID-0C09042A, comment: AcceptSecurityContext error, data 701, v3839": ErrAccountExpired,
+		"80090308: LdapErr: DSID-0C09042A, comment: AcceptSecurityContext error, data 773, v3839": ErrPasswordMustChange,
+		"80090308: LdapErr: DSID-0C09042A, comment: AcceptSecurityContext error, data 775, v3839": ErrAccountLocked,
+		"80090308: LdapErr: DSID-0C09042A, comment: AcceptSecurityContext error, data 569, v3839": ErrInvalidCredentials,
+		"Invalid Credentials": ErrInvalidCredentials,
+	}
+
+	for msg, reason := range tests {
+		var err error = newBindError(&ldap.Error{ResultCode: ldap.LDAPResultInvalidCredentials, Err: errors.New(msg)})
+		if !errors.Is(err, reason) {
+			t.Errorf("Expected %q to be %v but got: %v", msg, reason, err)
+		}
+
+		var bindErr *BindError
+		if !errors.As(err, &bindErr) {
+			t.Fatalf("Expected %q to be a *BindError", msg)
+		}
+		if bindErr.Err == nil {
+			t.Errorf("Expected %q to keep LDAP error", msg)
+		}
+	}
+
+	err := newBindError(&ldap.Error{ResultCode: ldap.LDAPResultInvalidCredentials, Err: errors.New("data 775")})
+	if err.Code != ADCodeAccountLocked {
+		t.Errorf("Expected code to be %x but got %x", ADCodeAccountLocked, err.Code)
+	}
+}
+
+func TestModifyError(t *testing.T) {
+	tests := map[string]error{
+		"00000562: UpdErr: DSID-031A11E2, problem 6005 (ENTRY_EXISTS), data 0\n":     ErrAlreadyMember,
+		"00000561: SvcErr: DSID-031A1254, problem 5003 (WILL_NOT_PERFORM), data 0\n": ErrNotMember,
+		"00002071: UpdErr: DSID-030502F1, problem 6005 (ENTRY_EXISTS), data 0\n":     nil,
+		"Entry Already Exists": nil,
+	}
+
+	for msg, reason := range tests {
+		lerr := &ldap.Error{ResultCode: ldap.LDAPResultEntryAlreadyExists, Err: errors.New(msg)}
+		err := newModifyError(lerr)
+
+		var modifyErr *ModifyError
+		if !errors.As(err, &modifyErr) {
+			t.Fatalf("Expected %q to be a *ModifyError", msg)
+		}
+
+		if reason != nil && !errors.Is(err, reason) {
+			t.Errorf("Expected %q to be %v but got: %v", msg, reason, err)
+		}
+
+		if reason == nil && (modifyErr.Reason != nil || !errors.Is(err, lerr)) {
+			t.Errorf("Expected %q to have no reason but got: %v", msg, modifyErr.Reason)
+		}
+	}
+
+	if err := newModifyError(errors.New("other")); err.Error() != "other" {
+		t.Error("Expected non-LDAP error to be returned unchanged but got:", err)
+	}
+}
+
+func TestPasswordError(t *testing.T) {
+	tests := []struct {
+		code   uint16
+		msg    string
+		reason error
+	}{
+		{ldap.LDAPResultConstraintViolation, "00000056: AtrErr: DSID-03190F80, #1:\n\t0: 00000056: DSID-03190F80, problem 1005 (CONSTRAINT_ATT_TYPE), data 0, Att 9005a (unicodePwd)\n", ErrWrongPassword},
+		{ldap.LDAPResultConstraintViolation, "0000052D: Constraint violation - check password restrictions", ErrPasswordRestriction},
+		{ldap.LDAPResultInsufficientAccessRights, "00000005: SecErr: DSID-031A11F8, problem 4003 (INSUFF_ACCESS_RIGHTS), data 0\n", ErrInsufficientRights},
+		{ldap.LDAPResultInsufficientAccessRights, "Insufficient Access Rights", ErrInsufficientRights},
+		{ldap.LDAPResultUnwillingToPerform, "0000001F: SvcErr: DSID-031A12D2, problem 5003 (WILL_NOT_PERFORM), data 0\n", ErrEncryptionRequired},
+	}
+
+	for _, test := range tests {
+		err := newPasswordError(&ldap.Error{ResultCode: test.code, Err: errors.New(test.msg)}, false)
+		if !errors.Is(err, test.reason) {
+			t.Errorf("Expected %q to be %v but got: %v", test.msg, test.reason, err)
+		}
+	}
+
+	err := newPasswordError(&ldap.Error{ResultCode: ldap.LDAPResultOther, Err: errors.New("00002071: UpdErr: DSID-030502F1")}, false)
+	var modifyErr *ModifyError
+	if !errors.As(err, &modifyErr) || modifyErr.Reason != nil {
+		t.Error("Expected unknown code to have no reason but got:", err)
+	}
+
+	//over TLS, and with other result codes, the generic failure code has no known reason
+	for _, test := range []struct {
+		code      uint16
+		encrypted bool
+	}{
+		{ldap.LDAPResultUnwillingToPerform, true},
+		{ldap.LDAPResultOther, false},
+	} {
+		lerr := &ldap.Error{ResultCode: test.code, Err: errors.New("0000001F: SvcErr: DSID-031A12D2, problem 5003 (WILL_NOT_PERFORM), data 0\n")}
+		err = newPasswordError(lerr, test.encrypted)
+		if errors.Is(err, ErrEncryptionRequired) {
+			t.Errorf("Code %d, encrypted %v: Expected no encryption required error but got: %v", test.code, test.encrypted, err)
+		}
+		var unwrapped *ldap.Error
+		if !errors.As(err, &modifyErr) || modifyErr.Reason != nil || !errors.As(err, &unwrapped) || unwrapped != lerr {
+			t.Errorf("Code %d, encrypted %v: Expected unknown reason wrapping the LDAP error but got: %v", test.code, test.encrypted, err)
+		}
+	}
+}
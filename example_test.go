@@ -1,7 +1,9 @@
 package auth_test
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	auth "github.com/korylprince/go-ad-auth/v3"
 )
@@ -30,6 +32,34 @@ func ExampleAuthenticate() {
 	}
 }
 
+func ExampleAuthenticateContext() {
+	config := &auth.Config{
+		Server:   "ldap.example.com",
+		Port:     389,
+		BaseDN:   "OU=Users,DC=example,DC=com",
+		Security: auth.SecurityStartTLS,
+	}
+
+	username := "user"
+	password := "pass"
+
+	//give up if the server doesn't respond in time
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	status, err := auth.AuthenticateContext(ctx, config, username, password)
+
+	if err != nil {
+		//handle err, e.g. errors.Is(err, context.DeadlineExceeded)
+		return
+	}
+
+	if !status {
+		//handle failed authentication
+		return
+	}
+}
+
 func ExampleAuthenticateExtended() {
 	config := &auth.Config{
 		Server:   "ldap.example.com",
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+// FILETIME values Active Directory uses to mean "never", e.g. for accountExpires or lastLogonTimestamp
+const (
+	FileTimeNever    int64 = 0
+	FileTimeNeverMax int64 = math.MaxInt64
+)
+
+// number of 100-nanosecond intervals between 1601-01-01 and 1970-01-01
+const fileTimeEpoch = 116444736000000000
+
+const generalizedTimeLayout = "20060102150405.0Z0700"
+
+var ErrInvalidGeneralizedTime = errors.New("invalid generalized time")
+
+// FileTimeToTime converts a Windows FILETIME, the number of 100-nanosecond intervals since 1601-01-01 UTC, to a time.Time.
+// FileTimeNever and FileTimeNeverMax (and other non-positive values) return the zero time.Time, which can be checked with IsZero
+func FileTimeToTime(ft int64) time.Time {
+	if ft <= FileTimeNever || ft == FileTimeNeverMax {
+		return time.Time{}
+	}
+	ft -= fileTimeEpoch
+	return time.Unix(ft/1e7, (ft%1e7)*100).UTC()
+}
+
+// TimeToFileTime converts t to a Windows FILETIME. The zero time.Time returns FileTimeNever
+func TimeToFileTime(t time.Time) int64 {
+	if t.IsZero() {
+		return FileTimeNever
+	}
+	return t.Unix()*1e7 + int64(t.Nanosecond())/100 + fileTimeEpoch
+}
+
+// ParseFileTime parses the string representation of a FILETIME, e.g. the value of pwdLastSet, with the same "never" handling as FileTimeToTime
+func ParseFileTime(s string) (time.Time, error) {
+	ft, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid filetime (%s): %w", s, err)
+	}
+	return FileTimeToTime(ft), nil
+}
+
+// ParseGeneralizedTime parses an LDAP GeneralizedTime, e.g. the value of whenCreated ("20231015123456.0Z").
+// Fractional seconds and time zone offsets are supported. The returned time is in UTC
+func ParseGeneralizedTime(s string) (time.Time, error) {
+	// fractions may be separated by a comma
+	t, err := time.Parse("20060102150405Z0700", strings.Replace(s, ",", ".", 1))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w (%s): %v", ErrInvalidGeneralizedTime, s, err)
+	}
+	return t.UTC(), nil
+}
+
+// FormatGeneralizedTime formats t as a GeneralizedTime suitable for use in ldap filters.
+// e.g. filter := fmt.Sprintf("(whenChanged>=%s)", FormatGeneralizedTime(t))
+func FormatGeneralizedTime(t time.Time) string {
+	return t.UTC().Format(generalizedTimeLayout)
+}
+
+// GetFileTime returns the FILETIME attribute attr of entry, e.g. "pwdLastSet", as a time.Time.
+// A missing attribute returns the zero time.Time, the same as "never"
+func GetFileTime(entry *ldap.Entry, attr string) (time.Time, error) {
+	value := entry.GetAttributeValue(attr)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return ParseFileTime(value)
+}
+
+// GetGeneralizedTime returns the GeneralizedTime attribute attr of entry, e.g. "whenCreated", as a time.Time.
+// A missing attribute returns the zero time.Time
+func GetGeneralizedTime(entry *ldap.Entry, attr string) (time.Time, error) {
+	value := entry.GetAttributeValue(attr)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return ParseGeneralizedTime(value)
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+func TestFileTime(t *testing.T) {
+	start := time.Date(2023, 10, 17, 12, 16, 0, 123456700, time.UTC)
+	startft := int64(133420185601234567)
+
+	if ft := TimeToFileTime(start); ft != startft {
+		t.Errorf("expected filetime to be equal: want: %d, have: %d", startft, ft)
+	}
+
+	if tm := FileTimeToTime(startft); !tm.Equal(start) {
+		t.Errorf("expected time to be equal: want: %v, have: %v", start, tm)
+	}
+
+	if tm := FileTimeToTime(fileTimeEpoch); !tm.Equal(time.Unix(0, 0)) {
+		t.Errorf("expected time to be unix epoch, have: %v", tm)
+	}
+
+	for _, ft := range []int64{FileTimeNever, FileTimeNeverMax, -1} {
+		if tm := FileTimeToTime(ft); !tm.IsZero() {
+			t.Errorf("expected filetime %d to be never, have: %v", ft, tm)
+		}
+	}
+
+	if ft := TimeToFileTime(time.Time{}); ft != FileTimeNever {
+		t.Errorf("expected zero time to be never, have: %d", ft)
+	}
+
+	if _, err := ParseFileTime("not a number"); err == nil {
+		t.Error("expected invalid filetime to fail")
+	}
+}
+
+func TestGeneralizedTime(t *testing.T) {
+	tests := map[string]time.Time{
+		"20231015123456.0Z":     time.Date(2023, 10, 15, 12, 34, 56, 0, time.UTC),
+		"20231015123456Z":       time.Date(2023, 10, 15, 12, 34, 56, 0, time.UTC),
+		"20231015123456,5Z":     time.Date(2023, 10, 15, 12, 34, 56, 500000000, time.UTC),
+		"20231015123456.0-0500": time.Date(2023, 10, 15, 17, 34, 56, 0, time.UTC),
+		"16010101000000.0Z":     time.Date(1601, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	for s, want := range tests {
+		have, err := ParseGeneralizedTime(s)
+		if err != nil {
+			t.Errorf("could not parse %s: %v", s, err)
+			continue
+		}
+		if !have.Equal(want) || have.Location() != time.UTC {
+			t.Errorf("expected time to be equal: want: %v, have: %v", want, have)
+		}
+	}
+
+	for _, s := range []string{"", "2023-10-15T12:34:56Z", "20231015"} {
+		if _, err := ParseGeneralizedTime(s); err == nil {
+			t.Errorf("expected %q to fail", s)
+		}
+	}
+
+	if s := FormatGeneralizedTime(time.Date(2023, 10, 15, 7, 34, 56, 0, time.FixedZone("", -5*60*60))); s != "20231015123456.0Z" {
+		t.Errorf("expected formatted time to be equal: want: 20231015123456.0Z, have: %s", s)
+	}
+}
+
+func TestGetTime(t *testing.T) {
+	entry := ldap.NewEntry("CN=Test,DC=example,DC=com", map[string][]string{
+		"pwdLastSet":     {"133420185600000000"},
+		"accountExpires": {"9223372036854775807"},
+		"whenCreated":    {"20231015123456.0Z"},
+		"badValue":       {"bad"},
+	})
+
+	if tm, err := GetFileTime(entry, "pwdLastSet"); err != nil || !tm.Equal(time.Date(2023, 10, 17, 12, 16, 0, 0, time.UTC)) {
+		t.Errorf("expected pwdLastSet to be parsed, have: %v, %v", tm, err)
+	}
+
+	for _, attr := range []string{"accountExpires", "lastLogonTimestamp"} {
+		if tm, err := GetFileTime(entry, attr); err != nil || !tm.IsZero() {
+			t.Errorf("expected %s to be never, have: %v, %v", attr, tm, err)
+		}
+	}
+
+	if tm, err := GetGeneralizedTime(entry, "whenCreated"); err != nil || !tm.Equal(time.Date(2023, 10, 15, 12, 34, 56, 0, time.UTC)) {
+		t.Errorf("expected whenCreated to be parsed, have: %v, %v", tm, err)
+	}
+
+	if _, err := GetFileTime(entry, "badValue"); err == nil {
+		t.Error("expected invalid filetime to fail")
+	}
+
+	if _, err := GetGeneralizedTime(entry, "badValue"); err == nil {
+		t.Error("expected invalid generalized time to fail")
+	}
+}
@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+// UserAccountControl represents the flags of the userAccountControl attribute,
+// described at https://learn.microsoft.com/en-us/troubleshoot/windows-server/active-directory/useraccountcontrol-manipulate-account-properties
+type UserAccountControl uint32
+
+// UserAccountControl flags
+const (
+	UACScript                       UserAccountControl = 0x1
+	UACAccountDisable               UserAccountControl = 0x2
+	UACHomeDirRequired              UserAccountControl = 0x8
+	UACLockout                      UserAccountControl = 0x10
+	UACPasswordNotRequired          UserAccountControl = 0x20
+	UACPasswordCantChange           UserAccountControl = 0x40
+	UACEncryptedTextPasswordAllowed UserAccountControl = 0x80
+	UACTempDuplicateAccount         UserAccountControl = 0x100
+	UACNormalAccount                UserAccountControl = 0x200
+	UACInterdomainTrustAccount      UserAccountControl = 0x800
+	UACWorkstationTrustAccount      UserAccountControl = 0x1000
+	UACServerTrustAccount           UserAccountControl = 0x2000
+	UACDontExpirePassword           UserAccountControl = 0x10000
+	UACMNSLogonAccount              UserAccountControl = 0x20000
+	UACSmartcardRequired            UserAccountControl = 0x40000
+	UACTrustedForDelegation         UserAccountControl = 0x80000
+	UACNotDelegated                 UserAccountControl = 0x100000
+	UACUseDESKeyOnly                UserAccountControl = 0x200000
+	UACDontRequirePreauth           UserAccountControl = 0x400000
+	UACPasswordExpired              UserAccountControl = 0x800000
+	UACTrustedToAuthForDelegation   UserAccountControl = 0x1000000
+	UACPartialSecretsAccount        UserAccountControl = 0x4000000
+)
+
+var uacNames = []flagName{
+	{uint32(UACScript), "SCRIPT"},
+	{uint32(UACAccountDisable), "ACCOUNTDISABLE"},
+	{uint32(UACHomeDirRequired), "HOMEDIR_REQUIRED"},
+	{uint32(UACLockout), "LOCKOUT"},
+	{uint32(UACPasswordNotRequired), "PASSWD_NOTREQD"},
+	{uint32(UACPasswordCantChange), "PASSWD_CANT_CHANGE"},
+	{uint32(UACEncryptedTextPasswordAllowed), "ENCRYPTED_TEXT_PWD_ALLOWED"},
+	{uint32(UACTempDuplicateAccount), "TEMP_DUPLICATE_ACCOUNT"},
+	{uint32(UACNormalAccount), "NORMAL_ACCOUNT"},
+	{uint32(UACInterdomainTrustAccount), "INTERDOMAIN_TRUST_ACCOUNT"},
+	{uint32(UACWorkstationTrustAccount), "WORKSTATION_TRUST_ACCOUNT"},
+	{uint32(UACServerTrustAccount), "SERVER_TRUST_ACCOUNT"},
+	{uint32(UACDontExpirePassword), "DONT_EXPIRE_PASSWORD"},
+	{uint32(UACMNSLogonAccount), "MNS_LOGON_ACCOUNT"},
+	{uint32(UACSmartcardRequired), "SMARTCARD_REQUIRED"},
+	{uint32(UACTrustedForDelegation), "TRUSTED_FOR_DELEGATION"},
+	{uint32(UACNotDelegated), "NOT_DELEGATED"},
+	{uint32(UACUseDESKeyOnly), "USE_DES_KEY_ONLY"},
+	{uint32(UACDontRequirePreauth), "DONT_REQ_PREAUTH"},
+	{uint32(UACPasswordExpired), "PASSWORD_EXPIRED"},
+	{uint32(UACTrustedToAuthForDelegation), "TRUSTED_TO_AUTH_FOR_DELEGATION"},
+	{uint32(UACPartialSecretsAccount), "PARTIAL_SECRETS_ACCOUNT"},
+}
+
+// Has returns true if all of the given flags are set
+func (uac UserAccountControl) Has(flag UserAccountControl) bool {
+	return uac&flag == flag
+}
+
+// String returns the names of the set flags joined with "|", e.g. "NORMAL_ACCOUNT|DONT_EXPIRE_PASSWORD".
+// Unknown flags are formatted in hex
+func (uac UserAccountControl) String() string {
+	return formatFlags(uint32(uac), uacNames)
+}
+
+// ParseUserAccountControl parses the string representation of a userAccountControl value, e.g. "66048"
+func ParseUserAccountControl(s string) (UserAccountControl, error) {
+	flags, err := parseFlags(s)
+	return UserAccountControl(flags), err
+}
+
+// GetUserAccountControl returns the userAccountControl attribute of entry
+func GetUserAccountControl(entry *ldap.Entry) (UserAccountControl, error) {
+	value := entry.GetAttributeValue("userAccountControl")
+	if value == "" {
+		return 0, errors.New("userAccountControl not found")
+	}
+	return ParseUserAccountControl(value)
+}
+
+// GroupType represents the flags of the groupType attribute, described at https://learn.microsoft.com/en-us/windows/win32/adschema/a-grouptype.
+// Active Directory stores groupType as a signed integer, so security groups are negative
+type GroupType uint32
+
+// GroupType flags
+const (
+	GroupTypeBuiltinLocal GroupType = 0x1
+	GroupTypeGlobal       GroupType = 0x2
+	GroupTypeDomainLocal  GroupType = 0x4
+	GroupTypeUniversal    GroupType = 0x8
+	GroupTypeAppBasic     GroupType = 0x10
+	GroupTypeAppQuery     GroupType = 0x20
+	GroupTypeSecurity     GroupType = 0x80000000
+)
+
+var groupTypeNames = []flagName{
+	{uint32(GroupTypeBuiltinLocal), "BUILTIN_LOCAL_GROUP"},
+	{uint32(GroupTypeGlobal), "ACCOUNT_GROUP"},
+	{uint32(GroupTypeDomainLocal), "RESOURCE_GROUP"},
+	{uint32(GroupTypeUniversal), "UNIVERSAL_GROUP"},
+	{uint32(GroupTypeAppBasic), "APP_BASIC_GROUP"},
+	{uint32(GroupTypeAppQuery), "APP_QUERY_GROUP"},
+	{uint32(GroupTypeSecurity), "SECURITY_ENABLED"},
+}
+
+// Has returns true if all of the given flags are set
+func (gt GroupType) Has(flag GroupType) bool {
+	return gt&flag == flag
+}
+
+// String returns the names of the set flags joined with "|", e.g. "ACCOUNT_GROUP|SECURITY_ENABLED".
+// Unknown flags are formatted in hex
+func (gt GroupType) String() string {
+	return formatFlags(uint32(gt), groupTypeNames)
+}
+
+// ParseGroupType parses the string representation of a groupType value, e.g. "-2147483646"
+func ParseGroupType(s string) (GroupType, error) {
+	flags, err := parseFlags(s)
+	return GroupType(flags), err
+}
+
+// GetGroupType returns the groupType attribute of entry
+func GetGroupType(entry *ldap.Entry) (GroupType, error) {
+	value := entry.GetAttributeValue("groupType")
+	if value == "" {
+		return 0, errors.New("groupType not found")
+	}
+	return ParseGroupType(value)
+}
+
+type flagName struct {
+	flag uint32
+	name string
+}
+
+func formatFlags(flags uint32, names []flagName) string {
+	if flags == 0 {
+		return "0"
+	}
+
+	var strs []string
+	for _, n := range names {
+		if flags&n.flag != 0 {
+			strs = append(strs, n.name)
+			flags &^= n.flag
+		}
+	}
+	if flags != 0 {
+		strs = append(strs, fmt.Sprintf("0x%x", flags))
+	}
+
+	return strings.Join(strs, "|")
+}
+
+// parseFlags parses a 32-bit flag value, which Active Directory may return as signed or unsigned
+func parseFlags(s string) (uint32, error) {
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || i < math.MinInt32 || i > math.MaxUint32 {
+		return 0, fmt.Errorf("invalid flags (%s)", s)
+	}
+	return uint32(i), nil
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"testing"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+func TestUserAccountControl(t *testing.T) {
+	uac, err := ParseUserAccountControl("66050")
+	if err != nil {
+		t.Fatalf("could not parse userAccountControl: %v", err)
+	}
+
+	if !uac.Has(UACNormalAccount) || !uac.Has(UACAccountDisable|UACDontExpirePassword) {
+		t.Error("expected flags to be set")
+	}
+
+	if uac.Has(UACLockout) || uac.Has(UACNormalAccount|UACLockout) {
+		t.Error("expected flags to not be set")
+	}
+
+	if s := uac.String(); s != "ACCOUNTDISABLE|NORMAL_ACCOUNT|DONT_EXPIRE_PASSWORD" {
+		t.Errorf("expected string to be equal: want: ACCOUNTDISABLE|NORMAL_ACCOUNT|DONT_EXPIRE_PASSWORD, have: %s", s)
+	}
+
+	if s := (UACNormalAccount | 0x4).String(); s != "NORMAL_ACCOUNT|0x4" {
+		t.Errorf("expected string to be equal: want: NORMAL_ACCOUNT|0x4, have: %s", s)
+	}
+
+	if s := UserAccountControl(0).String(); s != "0" {
+		t.Errorf("expected string to be equal: want: 0, have: %s", s)
+	}
+
+	for _, s := range []string{"", "abc", "4294967296", "-2147483649"} {
+		if _, err := ParseUserAccountControl(s); err == nil {
+			t.Errorf("expected %q to fail", s)
+		}
+	}
+}
+
+func TestGroupType(t *testing.T) {
+	gt, err := ParseGroupType("-2147483646")
+	if err != nil {
+		t.Fatalf("could not parse groupType: %v", err)
+	}
+
+	if gt != GroupTypeSecurity|GroupTypeGlobal {
+		t.Errorf("expected groupType to be equal: want: %x, have: %x", GroupTypeSecurity|GroupTypeGlobal, uint32(gt))
+	}
+
+	if !gt.Has(GroupTypeSecurity) || gt.Has(GroupTypeUniversal) {
+		t.Error("expected flags to be equal")
+	}
+
+	if s := gt.String(); s != "ACCOUNT_GROUP|SECURITY_ENABLED" {
+		t.Errorf("expected string to be equal: want: ACCOUNT_GROUP|SECURITY_ENABLED, have: %s", s)
+	}
+
+	if gt, err = ParseGroupType("8"); err != nil || gt != GroupTypeUniversal {
+		t.Errorf("expected distribution group to be parsed, have: %v, %v", gt, err)
+	}
+}
+
+func TestGetFlags(t *testing.T) {
+	entry := ldap.NewEntry("CN=Test,DC=example,DC=com", map[string][]string{
+		"userAccountControl": {"512"},
+		"groupType":          {"-2147483644"},
+	})
+
+	if uac, err := GetUserAccountControl(entry); err != nil || uac != UACNormalAccount {
+		t.Errorf("expected userAccountControl to be parsed, have: %v, %v", uac, err)
+	}
+
+	if gt, err := GetGroupType(entry); err != nil || gt != GroupTypeSecurity|GroupTypeDomainLocal {
+		t.Errorf("expected groupType to be parsed, have: %v, %v", gt, err)
+	}
+
+	entry = ldap.NewEntry("CN=Test,DC=example,DC=com", nil)
+
+	if _, err := GetUserAccountControl(entry); err == nil {
+		t.Error("expected missing userAccountControl to fail")
+	}
+
+	if _, err := GetGroupType(entry); err == nil {
+		t.Error("expected missing groupType to fail")
+	}
+}
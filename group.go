@@ -1,15 +1,19 @@
 package auth
 
 import (
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
 )
 
 const LDAPMatchingRuleInChain = "1.2.840.113556.1.4.1941"
 
+//filterBatchSize is the number of values, e.g. SIDs or DNs, combined into a single search filter.
+const filterBatchSize = 100
+
 //GroupDN returns the DN of the group with the given cn or an error if one occurred.
 func (c *Conn) GroupDN(group string) (string, error) {
 	if strings.HasSuffix(group, c.Config.BaseDN) {
@@ -22,6 +26,7 @@ func (c *Conn) GroupDN(group string) (string, error) {
 //ObjectGroups returns which of the given groups (referenced by DN) the object with the given attribute value is in,
 //if any, or an error if one occurred.
 //Setting attr to "dn" and value to the DN of an object will avoid an extra LDAP search to get the object's DN.
+//Memberships are found according to Config.GroupStrategy.
 func (c *Conn) ObjectGroups(attr, value string, groups []string) ([]string, error) {
 	dn := value
 	if attr != "dn" {
@@ -59,30 +64,170 @@ func (c *Conn) ObjectPrimaryGroup(attr, value string) (string, error) {
 		return "", err
 	}
 
+	return c.primaryGroup(entry)
+}
+
+//primaryGroup returns the DN of the primary group of entry, which must have the objectSid and primaryGroupID attributes,
+//or an error if one occurred.
+func (c *Conn) primaryGroup(entry *ldap.Entry) (string, error) {
 	gidStr := entry.GetAttributeValue("primaryGroupID")
 	if gidStr == "" {
 		return "", errors.New("Search error: primaryGroupID not found")
 	}
 
-	gid, err := strconv.Atoi(entry.GetAttributeValue("primaryGroupID"))
+	gid, err := strconv.Atoi(gidStr)
 	if err != nil {
 		return "", fmt.Errorf(`Parse error: invalid primaryGroupID ("%s"): %w`, gidStr, err)
 	}
 
-	uSID := entry.GetRawAttributeValue("objectSid")
-	gSID := make([]byte, len(uSID))
-	copy(gSID, uSID)
-	binary.LittleEndian.PutUint32(gSID[len(gSID)-4:], uint32(gid))
-
-	encoded := ""
-	for _, b := range gSID {
-		encoded += fmt.Sprintf(`\%02x`, b)
+	sid := new(SID)
+	if err = sid.UnmarshalBinary(entry.GetRawAttributeValue("objectSid")); err != nil {
+		return "", fmt.Errorf("Parse error: invalid objectSid: %w", err)
 	}
+	if len(sid.SubAuthoritys) == 0 {
+		return "", errors.New("Parse error: invalid objectSid: no sub authorities")
+	}
+
+	//the primary group's SID is the object's domain SID with the primaryGroupID as RID
+	sid.SubAuthoritys[len(sid.SubAuthoritys)-1] = uint32(gid)
 
-	entry, err = c.SearchOne(fmt.Sprintf("(objectSid=%s)", encoded), nil)
+	//the primary group is found by SID from the domain root, since it's usually outside of Config.BaseDN, e.g. CN=Users
+	group, err := c.getEntry(fmt.Sprintf("<SID=%s>", sid), []string{""})
 	if err != nil {
 		return "", fmt.Errorf("Search error: primary group not found: %w", err)
 	}
 
-	return entry.DN, nil
+	return group.DN, nil
+}
+
+//withPrimaryGroup returns groups with the primary group of the object with the given DN, and the groups it is nested in, merged in
+//or an error if one occurred. Objects without a primary group, or whose primary group can't be found, return groups unchanged.
+func (c *Conn) withPrimaryGroup(dn string, groups []*ldap.Entry) ([]*ldap.Entry, error) {
+	entry, err := c.getEntry(dn, []string{"objectSid", "primaryGroupID"})
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.GetAttributeValue("primaryGroupID") == "" {
+		return groups, nil
+	}
+
+	primaryDN, err := c.primaryGroup(entry)
+	if err != nil {
+		//the primary group may not be visible to the bound user; report the memberships that were found
+		return groups, nil
+	}
+
+	parents, err := c.chainGroups(primaryDN)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{}, len(groups))
+	for _, group := range groups {
+		seen[strings.ToLower(group.DN)] = struct{}{}
+	}
+
+	for _, group := range append([]*ldap.Entry{ldap.NewEntry(primaryDN, nil)}, parents...) {
+		if _, ok := seen[strings.ToLower(group.DN)]; !ok {
+			seen[strings.ToLower(group.DN)] = struct{}{}
+			groups = append(groups, group)
+		}
+	}
+
+	return groups, nil
+}
+
+//getEntry returns the entry with the given DN and attributes or an error if one occurred.
+func (c *Conn) getEntry(dn string, attrs []string) (*ldap.Entry, error) {
+	search := ldap.NewSearchRequest(dn, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, 0, false, "(objectClass=*)", attrs, nil)
+
+	var result *ldap.SearchResult
+	err := c.do(func() (err error) {
+		result, err = c.Conn.Search(search)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Search error (%s): %w", dn, err)
+	}
+
+	if len(result.Entries) == 0 {
+		return nil, fmt.Errorf("Search error (%s): no entries returned", dn)
+	}
+
+	return result.Entries[0], nil
+}
+
+//TokenGroups returns the SIDs of all groups, including nested groups and the primary group, the object with the given DN
+//is a member of or an error if one occurred. The SIDs are read from the constructed tokenGroups attribute,
+//which only includes security groups.
+func (c *Conn) TokenGroups(dn string) ([]*SID, error) {
+	entry, err := c.getEntry(dn, []string{"tokenGroups"})
+	if err != nil {
+		return nil, err
+	}
+
+	raw := entry.GetRawAttributeValues("tokenGroups")
+	sids := make([]*SID, len(raw))
+	for idx, buf := range raw {
+		sids[idx] = new(SID)
+		if err = sids[idx].UnmarshalBinary(buf); err != nil {
+			return nil, fmt.Errorf("Parse error: invalid tokenGroups SID: %w", err)
+		}
+	}
+
+	return sids, nil
+}
+
+//ResolveSIDs returns the DNs of the objects with the given SIDs or an error if one occurred.
+//SIDs are resolved in batches from the domain root, not Config.BaseDN, so groups outside of an OU used as BaseDN,
+//e.g. Domain Users, are found. SIDs of objects outside of the domain, e.g. of other domains, are skipped.
+func (c *Conn) ResolveSIDs(sids []*SID) ([]string, error) {
+	entries, err := c.resolveSIDs(sids)
+	if err != nil {
+		return nil, err
+	}
+
+	dns := make([]string, len(entries))
+	for idx, entry := range entries {
+		dns[idx] = entry.DN
+	}
+
+	return dns, nil
+}
+
+func (c *Conn) resolveSIDs(sids []*SID) ([]*ldap.Entry, error) {
+	if len(sids) == 0 {
+		return nil, nil
+	}
+
+	domainDN, err := c.domainDN()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*ldap.Entry
+	for start := 0; start < len(sids); start += filterBatchSize {
+		end := start + filterBatchSize
+		if end > len(sids) {
+			end = len(sids)
+		}
+
+		var filter strings.Builder
+		filter.WriteString("(|")
+		for _, sid := range sids[start:end] {
+			filter.WriteString(fmt.Sprintf("(objectSid=%s)", sid.FilterString()))
+		}
+		filter.WriteString(")")
+
+		it := c.SearchPages(domainDN, filter.String(), []string{""}, 0)
+		for it.Next() {
+			entries = append(entries, it.Entries()...)
+		}
+		if err = it.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
 }
@@ -1,9 +1,13 @@
 package auth
 
 import (
+	"net"
 	"sort"
 	"strings"
 	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
 )
 
 func dnToCN(dn string) string {
@@ -224,3 +228,251 @@ func TestConnObjectPrimaryGroup(t *testing.T) {
 		t.Error("Expected to primary group dn to not be empty")
 	}
 }
+
+func TestConnTokenGroups(t *testing.T) {
+	if testConfig.Server == "" {
+		t.Skip("ADTEST_SERVER not set")
+		return
+	}
+
+	if testConfig.BindUPN == "" || testConfig.BindPass == "" {
+		t.Skip("ADTEST_BIND_UPN or ADTEST_BIND_PASS not set")
+		return
+	}
+
+	if testConfig.BaseDN == "" {
+		t.Skip("ADTEST_BASEDN not set")
+		return
+	}
+
+	config := &Config{Server: testConfig.Server, Port: testConfig.Port, Security: testConfig.BindSecurity, BaseDN: testConfig.BaseDN, GroupStrategy: GroupsTokenGroups}
+	conn, err := config.Connect()
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Conn.Close()
+
+	status, err := conn.Bind(testConfig.BindUPN, testConfig.BindPass)
+	if err != nil {
+		t.Fatal("Error binding to server:", err)
+	}
+
+	if !status {
+		t.Fatal("Error binding to server: invalid credentials")
+	}
+
+	dn, err := conn.GetDN("userPrincipalName", testConfig.BindUPN)
+	if err != nil {
+		t.Fatal("Error getting user DN:", err)
+	}
+
+	if _, err = conn.TokenGroups("CN=false," + testConfig.BaseDN); err == nil {
+		t.Error("Invalid DN: Expected error but got nil")
+	}
+
+	sids, err := conn.TokenGroups(dn)
+	if err != nil {
+		t.Fatal("TokenGroups: Expected err to be nil but got:", err)
+	}
+
+	if len(sids) == 0 {
+		t.Fatal("TokenGroups: Expected at least the primary group to be returned")
+	}
+
+	dns, err := conn.ResolveSIDs(sids)
+	if err != nil {
+		t.Fatal("ResolveSIDs: Expected err to be nil but got:", err)
+	}
+
+	primaryGroup, err := conn.ObjectPrimaryGroup("userPrincipalName", testConfig.BindUPN)
+	if err != nil {
+		t.Fatal("ObjectPrimaryGroup: Expected err to be nil but got:", err)
+	}
+
+	userGroups, err := conn.ObjectGroups("dn", dn, dns)
+	if err != nil {
+		t.Fatal("ObjectGroups: Expected err to be nil but got:", err)
+	}
+
+	found := false
+	for _, group := range userGroups {
+		if group == primaryGroup {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Errorf("ObjectGroups: Expected primary group (%s) to be returned", primaryGroup)
+	}
+}
+
+func TestConnObjectGroupsPrimaryGroup(t *testing.T) {
+	if testConfig.Server == "" {
+		t.Skip("ADTEST_SERVER not set")
+		return
+	}
+
+	if testConfig.BindUPN == "" || testConfig.BindPass == "" {
+		t.Skip("ADTEST_BIND_UPN or ADTEST_BIND_PASS not set")
+		return
+	}
+
+	if testConfig.BaseDN == "" {
+		t.Skip("ADTEST_BASEDN not set")
+		return
+	}
+
+	config := &Config{Server: testConfig.Server, Port: testConfig.Port, Security: testConfig.BindSecurity, BaseDN: testConfig.BaseDN}
+	conn, err := config.Connect()
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Conn.Close()
+
+	status, err := conn.Bind(testConfig.BindUPN, testConfig.BindPass)
+	if err != nil {
+		t.Fatal("Error binding to server:", err)
+	}
+
+	if !status {
+		t.Fatal("Error binding to server: invalid credentials")
+	}
+
+	primaryGroup, err := conn.ObjectPrimaryGroup("userPrincipalName", testConfig.BindUPN)
+	if err != nil {
+		t.Fatal("ObjectPrimaryGroup: Expected err to be nil but got:", err)
+	}
+
+	userGroups, err := conn.ObjectGroups("userPrincipalName", testConfig.BindUPN, []string{primaryGroup})
+	if err != nil {
+		t.Fatal("Without primary group: Expected err to be nil but got:", err)
+	}
+
+	if len(userGroups) != 0 {
+		t.Error("Without primary group: Expected primary group to not be returned but got:", userGroups)
+	}
+
+	config.IncludePrimaryGroup = true
+
+	userGroups, err = conn.ObjectGroups("userPrincipalName", testConfig.BindUPN, []string{primaryGroup})
+	if err != nil {
+		t.Fatal("With primary group: Expected err to be nil but got:", err)
+	}
+
+	if len(userGroups) != 1 || userGroups[0] != primaryGroup {
+		t.Errorf("With primary group: Expected primary group (%s) to be returned but got: %v", primaryGroup, userGroups)
+	}
+
+	status, _, userGroups, err = AuthenticateExtended(config, testConfig.BindUPN, testConfig.BindPass, nil, []string{dnToCN(primaryGroup)})
+	if err != nil {
+		t.Fatal("AuthenticateExtended: Expected err to be nil but got:", err)
+	}
+
+	if !status || len(userGroups) != 1 {
+		t.Errorf("AuthenticateExtended: Expected primary group (%s) to be returned but got: %v", primaryGroup, userGroups)
+	}
+}
+
+//servePrimaryGroup answers searches on conn for the user CN=jdoe,OU=Users,DC=example,DC=com, whose primary group,
+//CN=Domain Users,CN=Users,DC=example,DC=com, is outside of the OU, until it's closed.
+//Its tokenGroups hold the SIDs of CN=Staff,OU=Users,DC=example,DC=com and Domain Users.
+//If resolveSID is false, <SID=...> searches fail like on a server that doesn't support them.
+func servePrimaryGroup(conn net.Conn, resolveSID bool) {
+	defer conn.Close()
+	var raw [3]string
+	for i, s := range []string{"S-1-5-21-1-2-3-1105", "S-1-5-21-1-2-3-1200", "S-1-5-21-1-2-3-513"} {
+		sid, _ := ParseSID(s)
+		b, _ := sid.MarshalBinary()
+		raw[i] = string(b)
+	}
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 || packet.Children[1].Tag != ldap.ApplicationSearchRequest {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		req := packet.Children[1]
+
+		var out []byte
+		code := int64(ldap.LDAPResultSuccess)
+		switch base := req.Children[0].Data.String(); base {
+		case "CN=jdoe,OU=Users,DC=example,DC=com":
+			out = ldapEntry(id, base, map[string][]string{"objectSid": {raw[0]}, "primaryGroupID": {"513"}, "tokenGroups": raw[1:]}).Bytes()
+		case "<SID=S-1-5-21-1-2-3-513>":
+			if !resolveSID {
+				code = ldap.LDAPResultNoSuchObject
+				break
+			}
+			out = ldapEntry(id, "CN=Domain Users,CN=Users,DC=example,DC=com", nil).Bytes()
+		case "":
+			out = ldapEntry(id, "", map[string][]string{"defaultNamingContext": {"DC=example,DC=com"}}).Bytes()
+		case "OU=Users,DC=example,DC=com":
+			//only groups in the OU are found under it; objectSid searches for the primary group find nothing
+			if filter, _ := ldap.DecompileFilter(req.Children[6]); strings.Contains(filter, "CN=jdoe,") || strings.Contains(filter, "objectSid") {
+				out = ldapEntry(id, "CN=Staff,OU=Users,DC=example,DC=com", nil).Bytes()
+			}
+		case "DC=example,DC=com":
+			//the objectSid searches for the user's tokenGroups
+			out = append(ldapEntry(id, "CN=Staff,OU=Users,DC=example,DC=com", nil).Bytes(),
+				ldapEntry(id, "CN=Domain Users,CN=Users,DC=example,DC=com", nil).Bytes()...)
+		default:
+			code = ldap.LDAPResultNoSuchObject
+		}
+		out = append(out, ldapResponse(id, ldap.ApplicationSearchResultDone, code).Bytes()...)
+
+		if _, err = conn.Write(out); err != nil {
+			return
+		}
+	}
+}
+
+func TestConnObjectGroupsPrimaryGroupOU(t *testing.T) {
+	groups := []string{"CN=Staff,OU=Users,DC=example,DC=com", "CN=Domain Users,CN=Users,DC=example,DC=com"}
+
+	for _, resolveSID := range []bool{true, false} {
+		client, server := net.Pipe()
+		go servePrimaryGroup(server, resolveSID)
+
+		ldapConn := ldap.NewConn(client, false)
+		ldapConn.Start()
+		config := &Config{BaseDN: "OU=Users,DC=example,DC=com", IncludePrimaryGroup: true}
+		conn := &Conn{Conn: ldapConn, Config: config, bound: new(bindState)}
+
+		expected := groups
+		if !resolveSID {
+			//an unresolved primary group is skipped instead of failing
+			expected = groups[:1]
+		}
+
+		userGroups, err := conn.ObjectGroups("dn", "CN=jdoe,OU=Users,DC=example,DC=com", groups)
+		if err != nil {
+			t.Errorf("resolveSID %v: Expected err to be nil but got: %v", resolveSID, err)
+		} else if strings.Join(userGroups, ";") != strings.Join(expected, ";") {
+			t.Errorf("resolveSID %v: Expected %v but got: %v", resolveSID, expected, userGroups)
+		}
+
+		ldapConn.Close()
+	}
+}
+
+func TestConnObjectGroupsTokenGroupsOU(t *testing.T) {
+	groups := []string{"CN=Staff,OU=Users,DC=example,DC=com", "CN=Domain Users,CN=Users,DC=example,DC=com"}
+
+	client, server := net.Pipe()
+	go servePrimaryGroup(server, true)
+
+	ldapConn := ldap.NewConn(client, false)
+	ldapConn.Start()
+	defer ldapConn.Close()
+	config := &Config{BaseDN: "OU=Users,DC=example,DC=com", GroupStrategy: GroupsTokenGroups}
+	conn := &Conn{Conn: ldapConn, Config: config, bound: new(bindState)}
+
+	//the primary group is outside of the OU but must still be found
+	userGroups, err := conn.ObjectGroups("dn", "CN=jdoe,OU=Users,DC=example,DC=com", groups)
+	if err != nil {
+		t.Fatal("Expected err to be nil but got:", err)
+	}
+	if strings.Join(userGroups, ";") != strings.Join(groups, ";") {
+		t.Errorf("Expected %v but got: %v", groups, userGroups)
+	}
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+//CreateGroup creates a group named name in the container or OU with the given DN and returns the new group's DN,
+//or returns an error if one occurred. name is used as both the cn and sAMAccountName.
+//groupType must have exactly one scope (GroupTypeGlobal, GroupTypeDomainLocal or GroupTypeUniversal),
+//and GroupTypeSecurity for a security group, e.g. GroupTypeGlobal|GroupTypeSecurity. Without GroupTypeSecurity a distribution group is created.
+func (c *Conn) CreateGroup(parentDN, name string, groupType GroupType) (string, error) {
+	switch groupType &^ GroupTypeSecurity {
+	case GroupTypeGlobal, GroupTypeDomainLocal, GroupTypeUniversal:
+	default:
+		return "", fmt.Errorf("Group error: invalid groupType (%v): exactly one scope is required", groupType)
+	}
+
+	dn := fmt.Sprintf("CN=%s,%s", escapeDN(name), parentDN)
+
+	req := ldap.NewAddRequest(dn, nil)
+	req.Attribute("objectClass", []string{"top", "group"})
+	req.Attribute("sAMAccountName", []string{name})
+	//groupType is stored as a signed 32-bit integer
+	req.Attribute("groupType", []string{strconv.FormatInt(int64(int32(groupType)), 10)})
+
+	err := c.do(func() error {
+		return c.Conn.Add(req)
+	})
+	if err != nil {
+		return "", fmt.Errorf("Group error: Unable to create group (%s): %w", dn, newModifyError(err))
+	}
+
+	return dn, nil
+}
+
+//DeleteGroup deletes the given group (referenced by DN or cn) or returns an error if one occurred.
+func (c *Conn) DeleteGroup(group string) error {
+	dn, err := c.GroupDN(group)
+	if err != nil {
+		return err
+	}
+
+	req := ldap.NewDelRequest(dn, nil)
+	err = c.do(func() error {
+		return c.Conn.Del(req)
+	})
+	if err != nil {
+		return fmt.Errorf("Group error: Unable to delete group (%s): %w", dn, newModifyError(err))
+	}
+
+	return nil
+}
+
+//AddGroupMember adds member to the given group (referenced by DN or cn) or returns an error if one occurred.
+//member may be a DN, a userPrincipalName, or a SID string, e.g. "S-1-5-21-...".
+//If member is already in the group, the returned error wraps ErrAlreadyMember.
+func (c *Conn) AddGroupMember(group, member string) error {
+	return c.modifyGroupMember(group, member, true)
+}
+
+//RemoveGroupMember removes member from the given group (referenced by DN or cn) or returns an error if one occurred.
+//member may be a DN, a userPrincipalName, or a SID string, e.g. "S-1-5-21-...".
+//If member isn't in the group, the returned error wraps ErrNotMember.
+func (c *Conn) RemoveGroupMember(group, member string) error {
+	return c.modifyGroupMember(group, member, false)
+}
+
+func (c *Conn) modifyGroupMember(group, member string, add bool) error {
+	groupDN, err := c.GroupDN(group)
+	if err != nil {
+		return err
+	}
+
+	memberDN, err := c.memberDN(member)
+	if err != nil {
+		return err
+	}
+
+	req := ldap.NewModifyRequest(groupDN, nil)
+	action := "add"
+	if add {
+		req.Add("member", []string{memberDN})
+	} else {
+		action = "remove"
+		req.Delete("member", []string{memberDN})
+	}
+
+	err = c.do(func() error {
+		return c.Conn.Modify(req)
+	})
+	if err != nil {
+		return fmt.Errorf("Group error: Unable to %s member (%s) of %s: %w", action, member, groupDN, newModifyError(err))
+	}
+
+	return nil
+}
+
+//memberDN returns the value used in a group's member attribute for the given DN, userPrincipalName, or SID string.
+//SIDs are given in Active Directory's extended DN syntax ("<SID=S-1-5-...>"), which also works for foreign security principals.
+func (c *Conn) memberDN(member string) (string, error) {
+	switch {
+	case strings.HasPrefix(strings.ToUpper(member), "S-1-"):
+		sid, err := ParseSID(strings.ToUpper(member))
+		if err != nil {
+			return "", fmt.Errorf(`Parse error: invalid SID "%s": %w`, member, err)
+		}
+		return fmt.Sprintf("<SID=%s>", sid.String()), nil
+	case strings.Contains(member, "="):
+		return member, nil
+	case strings.Contains(member, "@"):
+		return c.GetDN("userPrincipalName", member)
+	}
+
+	return "", errors.New("Parse error: member must be a DN, userPrincipalName, or SID")
+}
+
+//escapeDN escapes value for use as an attribute value in a DN, as described in RFC 4514.
+func escapeDN(value string) string {
+	var escaped strings.Builder
+	for idx, r := range value {
+		switch {
+		case strings.ContainsRune(`,+"\<>;=`, r),
+			idx == 0 && (r == ' ' || r == '#'),
+			idx == len(value)-1 && r == ' ':
+			escaped.WriteRune('\\')
+			escaped.WriteRune(r)
+		case r == 0:
+			escaped.WriteString(`\00`)
+		default:
+			escaped.WriteRune(r)
+		}
+	}
+	return escaped.String()
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestEscapeDN(t *testing.T) {
+	tests := map[string]string{
+		"John Doe":    "John Doe",
+		"Doe, John":   `Doe\, John`,
+		" leading":    `\ leading`,
+		"trailing ":   `trailing\ `,
+		"#hash":       `\#hash`,
+		"a+b=c;d<e>f": `a\+b\=c\;d\<e\>f`,
+		`quote"back\`: `quote\"back\\`,
+		"nul\x00":     `nul\00`,
+		"mid # space": "mid # space",
+	}
+
+	for value, want := range tests {
+		if have := escapeDN(value); have != want {
+			t.Errorf("expected escaped value to be equal: want: %s, have: %s", want, have)
+		}
+	}
+}
+
+func TestConnGroupAdmin(t *testing.T) {
+	if testConfig.Server == "" {
+		t.Skip("ADTEST_SERVER not set")
+		return
+	}
+
+	if testConfig.BindUPN == "" || testConfig.BindPass == "" {
+		t.Skip("ADTEST_BIND_UPN or ADTEST_BIND_PASS not set")
+		return
+	}
+
+	if testConfig.BaseDN == "" {
+		t.Skip("ADTEST_BASEDN not set")
+		return
+	}
+
+	if testConfig.AdminOU == "" {
+		t.Skip("ADTEST_ADMIN_OU not set")
+		return
+	}
+
+	config := &Config{Server: testConfig.Server, Port: testConfig.Port, Security: testConfig.BindSecurity, BaseDN: testConfig.BaseDN}
+	conn, err := config.Connect()
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Conn.Close()
+
+	status, err := conn.Bind(testConfig.BindUPN, testConfig.BindPass)
+	if err != nil {
+		t.Fatal("Error binding to server:", err)
+	}
+
+	if !status {
+		t.Fatal("Error binding to server: invalid credentials")
+	}
+
+	if _, err = conn.CreateGroup(testConfig.AdminOU, "invalid", GroupTypeSecurity); err == nil {
+		t.Error("Invalid scope: Expected error but got nil")
+	}
+
+	name := fmt.Sprintf("go-ad-auth-test-%d", time.Now().UnixNano())
+	dn, err := conn.CreateGroup(testConfig.AdminOU, name, GroupTypeGlobal|GroupTypeSecurity)
+	if err != nil {
+		t.Fatal("CreateGroup: Expected err to be nil but got:", err)
+	}
+	defer func() {
+		if err := conn.DeleteGroup(dn); err != nil {
+			t.Error("DeleteGroup: Expected err to be nil but got:", err)
+		}
+	}()
+
+	entry, err := conn.GetAttributes("userPrincipalName", testConfig.BindUPN, []string{"objectSid"})
+	if err != nil {
+		t.Fatal("Error getting user:", err)
+	}
+
+	sid := new(SID)
+	if err = sid.UnmarshalBinary(entry.GetRawAttributeValue("objectSid")); err != nil {
+		t.Fatal("Error parsing user SID:", err)
+	}
+
+	for _, member := range []string{entry.DN, testConfig.BindUPN, sid.String()} {
+		if err = conn.AddGroupMember(dn, member); err != nil {
+			t.Fatalf("AddGroupMember (%s): Expected err to be nil but got: %v", member, err)
+		}
+
+		if err = conn.AddGroupMember(dn, member); !errors.Is(err, ErrAlreadyMember) {
+			t.Errorf("AddGroupMember (%s): Expected ErrAlreadyMember but got: %v", member, err)
+		}
+
+		if err = conn.RemoveGroupMember(dn, member); err != nil {
+			t.Fatalf("RemoveGroupMember (%s): Expected err to be nil but got: %v", member, err)
+		}
+
+		if err = conn.RemoveGroupMember(dn, member); !errors.Is(err, ErrNotMember) {
+			t.Errorf("RemoveGroupMember (%s): Expected ErrNotMember but got: %v", member, err)
+		}
+	}
+
+	if err = conn.AddGroupMember(dn, "invalid"); err == nil {
+		t.Error("Invalid member: Expected error but got nil")
+	}
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidGUID = errors.New("invalid guid")
+
+// GUID represents an objectGUID, stored in the binary layout Active Directory uses.
+// The first three fields of the binary layout are little endian, described at https://learn.microsoft.com/en-us/windows/win32/api/guiddef/ns-guiddef-guid
+type GUID [16]byte
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface
+func (guid *GUID) UnmarshalBinary(buf []byte) error {
+	if len(buf) != 16 {
+		return ErrInvalidGUID
+	}
+	copy(guid[:], buf)
+	return nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface
+func (guid GUID) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 16)
+	copy(buf, guid[:])
+	return buf, nil
+}
+
+// String returns the canonical string representation of guid, e.g. "f81d4fae-7dec-11d0-a765-00a0c91e6bf6"
+func (guid GUID) String() string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(guid[0:4]),
+		binary.LittleEndian.Uint16(guid[4:6]),
+		binary.LittleEndian.Uint16(guid[6:8]),
+		guid[8:10],
+		guid[10:16],
+	)
+}
+
+// ParseGUID parses the canonical string representation of a GUID, e.g. what GUID.String returns.
+// Surrounding braces, e.g. "{f81d4fae-7dec-11d0-a765-00a0c91e6bf6}", are allowed
+func ParseGUID(s string) (GUID, error) {
+	var guid GUID
+	if len(s) == 38 && s[0] == '{' && s[37] == '}' {
+		s = s[1:37]
+	}
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return guid, ErrInvalidGUID
+	}
+
+	buf, err := hex.DecodeString(strings.Replace(s, "-", "", 4))
+	if err != nil || len(buf) != 16 {
+		return guid, ErrInvalidGUID
+	}
+
+	binary.LittleEndian.PutUint32(guid[0:4], binary.BigEndian.Uint32(buf[0:4]))
+	binary.LittleEndian.PutUint16(guid[4:6], binary.BigEndian.Uint16(buf[4:6]))
+	binary.LittleEndian.PutUint16(guid[6:8], binary.BigEndian.Uint16(buf[6:8]))
+	copy(guid[8:], buf[8:])
+
+	return guid, nil
+}
+
+// IsZero returns true if guid is the nil GUID
+func (guid GUID) IsZero() bool {
+	return guid == GUID{}
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. GUIDs are marshaled to JSON as strings
+func (guid GUID) MarshalText() ([]byte, error) {
+	return []byte(guid.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface
+func (guid *GUID) UnmarshalText(buf []byte) error {
+	parsed, err := ParseGUID(string(buf))
+	if err != nil {
+		return err
+	}
+	*guid = parsed
+	return nil
+}
+
+// FilterString returns an escaped binary representation of guid suitable for use in ldap filters.
+// e.g. filter := fmt.Sprintf("(objectGUID=%s)", guid.FilterString())
+func (guid GUID) FilterString() string {
+	var filter strings.Builder
+	for _, b := range guid {
+		filter.WriteString(fmt.Sprintf(`\%02x`, b))
+	}
+
+	return filter.String()
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+var ErrGUIDTests = []string{
+	"f81d4fae7dec11d0a76500a0c91e6bf6",       // no dashes
+	"f81d4fae-7dec-11d0-a765-00a0c91e6bf",    // too short
+	"f81d4fae-7dec-11d0-a765-00a0c91e6bfg",   // invalid hex
+	"f81d4fae-7dec-11d0-a76500-a0c91e6bf6",   // misplaced dash
+	"{f81d4fae-7dec-11d0-a765-00a0c91e6bf6",  // missing brace
+	"(f81d4fae-7dec-11d0-a765-00a0c91e6bf6)", // wrong braces
+}
+
+func TestGUID(t *testing.T) {
+	// taken from RFC 4122, stored in AD's mixed-endian layout
+	start := "f81d4fae-7dec-11d0-a765-00a0c91e6bf6"
+	startbin := []byte{0xae, 0x4f, 0x1d, 0xf8, 0xec, 0x7d, 0xd0, 0x11, 0xa7, 0x65, 0x00, 0xa0, 0xc9, 0x1e, 0x6b, 0xf6}
+	startfilter := `\ae\4f\1d\f8\ec\7d\d0\11\a7\65\00\a0\c9\1e\6b\f6`
+
+	guid, err := ParseGUID(start)
+	if err != nil {
+		t.Fatalf("could not parse guid: %v", err)
+	}
+
+	if start != guid.String() {
+		t.Error("expected parsed string to be equal")
+	}
+
+	if guid.FilterString() != startfilter {
+		t.Error("expected filter string to be equal")
+	}
+
+	buf, err := guid.MarshalBinary()
+	if err != nil {
+		t.Fatalf("could not marshal guid: %v", err)
+	}
+
+	if !bytes.Equal(buf, startbin) {
+		t.Error("expected marshaled binary to be equal")
+	}
+
+	var guid2 GUID
+	if err = guid2.UnmarshalBinary(startbin); err != nil {
+		t.Fatalf("could not unmarshal guid: %v", err)
+	}
+
+	if guid != guid2 {
+		t.Error("expected unmarshaled guid to be equal")
+	}
+
+	if guid3, err := ParseGUID("{F81D4FAE-7DEC-11D0-A765-00A0C91E6BF6}"); err != nil || guid3 != guid {
+		t.Errorf("expected braced upper case guid to be equal: %v", err)
+	}
+
+	if guid.IsZero() || !(GUID{}).IsZero() {
+		t.Error("expected IsZero to be correct")
+	}
+
+	if err = guid2.UnmarshalBinary(startbin[:15]); err != ErrInvalidGUID {
+		t.Errorf("expected short binary to fail with ErrInvalidGUID, have: %v", err)
+	}
+
+	for _, s := range ErrGUIDTests {
+		if _, err = ParseGUID(s); err != ErrInvalidGUID {
+			t.Errorf("expected %s to fail with ErrInvalidGUID, have: %v", s, err)
+		}
+	}
+}
+
+func TestGUIDJSON(t *testing.T) {
+	type object struct {
+		GUID GUID `json:"guid"`
+	}
+
+	guid, err := ParseGUID("f81d4fae-7dec-11d0-a765-00a0c91e6bf6")
+	if err != nil {
+		t.Fatalf("could not parse guid: %v", err)
+	}
+
+	buf, err := json.Marshal(object{GUID: guid})
+	if err != nil {
+		t.Fatalf("could not marshal json: %v", err)
+	}
+
+	if string(buf) != `{"guid":"f81d4fae-7dec-11d0-a765-00a0c91e6bf6"}` {
+		t.Errorf("expected json to be equal, have: %s", buf)
+	}
+
+	var obj object
+	if err = json.Unmarshal(buf, &obj); err != nil {
+		t.Fatalf("could not unmarshal json: %v", err)
+	}
+
+	if obj.GUID != guid {
+		t.Error("expected unmarshaled guid to be equal")
+	}
+
+	if err = json.Unmarshal([]byte(`{"guid":"invalid"}`), &obj); err == nil {
+		t.Error("expected invalid guid to fail")
+	}
+}
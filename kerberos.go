@@ -0,0 +1,467 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
+	"github.com/jcmturner/gokrb5/v8/client"
+	krb5config "github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/crypto/etype"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/flags"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+//KerberosConfig contains the credentials Conn.GSSAPIBind authenticates with.
+//If Keytab is set, the keys in it are used to log in as Username; otherwise the tickets in CCache are used.
+type KerberosConfig struct {
+	//Krb5Conf is the path of the krb5.conf file. If empty, $KRB5_CONFIG or /etc/krb5.conf is used.
+	Krb5Conf string
+	//Keytab is the path of a keytab holding the keys of Username.
+	Keytab string
+	//Username is the principal to log in as with Keytab, e.g. "svc-ldap" or "host/app.example.com".
+	Username string
+	//Realm is the realm of Username. If empty, the default realm of Krb5Conf is used.
+	Realm string
+	//CCache is the path of a credential cache, e.g. one populated by kinit. If empty, $KRB5CCNAME or /tmp/krb5cc_<uid> is used.
+	//Only file credential caches are supported.
+	CCache string
+	//SPN is the service principal name of the LDAP server. If empty, "ldap/<server>" is used with Config.ServerName or the server
+	//that was connected to, so SPN or Config.ServerName must be set if the server is given as an IP address.
+	SPN string
+	//Protection controls whether traffic is signed or sealed after the bind. The session key must use an AES encryption type
+	//with any Protection, including ProtectionNone, since the last step of the bind is always protected with it.
+	Protection SASLProtection
+}
+
+func (k *KerberosConfig) krb5Conf() string {
+	if k.Krb5Conf != "" {
+		return k.Krb5Conf
+	}
+	if path := os.Getenv("KRB5_CONFIG"); path != "" {
+		return path
+	}
+	return "/etc/krb5.conf"
+}
+
+func (k *KerberosConfig) ccache() (string, error) {
+	path := k.CCache
+	if path == "" {
+		path = os.Getenv("KRB5CCNAME")
+	}
+	if path == "" {
+		return fmt.Sprintf("/tmp/krb5cc_%d", os.Getuid()), nil
+	}
+
+	if i := strings.Index(path, ":"); i > 1 {
+		if !strings.EqualFold(path[:i], "FILE") {
+			return "", fmt.Errorf("unsupported credential cache type: %s", path[:i])
+		}
+		path = path[i+1:]
+	}
+
+	return path, nil
+}
+
+//client returns a Kerberos client for the configured keytab or credential cache.
+func (k *KerberosConfig) client() (*client.Client, error) {
+	conf, err := krb5config.Load(k.krb5Conf())
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load krb5.conf: %w", err)
+	}
+
+	if k.Keytab != "" {
+		kt, err := keytab.Load(k.Keytab)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to load keytab: %w", err)
+		}
+
+		realm := k.Realm
+		if realm == "" {
+			realm = conf.LibDefaults.DefaultRealm
+		}
+
+		//Active Directory doesn't support FAST
+		return client.NewWithKeytab(k.Username, realm, kt, conf, client.DisablePAFXFAST(true)), nil
+	}
+
+	path, err := k.ccache()
+	if err != nil {
+		return nil, err
+	}
+
+	cc, err := credentials.LoadCCache(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load credential cache: %w", err)
+	}
+
+	return client.NewFromCCache(cc, conf, client.DisablePAFXFAST(true))
+}
+
+//GSSAPIBind authenticates the connection with Kerberos (SASL GSSAPI) using Config.Kerberos, or returns an error if one occurred.
+//Depending on KerberosConfig.Protection, all traffic after the bind is signed or sealed. Signing and sealing are only available
+//on connections made with SecurityNone, and once installed, they stay in place for the life of the connection.
+//The service ticket's session key must use an AES encryption type, even over TLS or with ProtectionNone, since the
+//security layer negotiation at the end of the bind is protected with it; RC4 keys are rejected.
+func (c *Conn) GSSAPIBind() error {
+	if c.Config == nil || c.Config.Kerberos == nil {
+		return errors.New("Configuration error: Kerberos not configured")
+	}
+	k := c.Config.Kerberos
+
+	if c.hasSecurityLayer() {
+		return errors.New("Bind error: connection already has a SASL security layer")
+	}
+
+	cl, err := k.client()
+	if err != nil {
+		return fmt.Errorf("Bind error: %w", err)
+	}
+	defer cl.Destroy()
+
+	principal := fmt.Sprintf("%s@%s", cl.Credentials.CName().PrincipalNameString(), cl.Credentials.Realm())
+
+	spn := k.SPN
+	if spn == "" {
+		spn = "ldap/" + c.host
+	}
+
+	gc := &krb5Client{client: cl, protection: k.Protection, layers: c.sasl != nil}
+	err = c.do(func() error {
+		return c.Conn.GSSAPIBindRequest(gc, &ldap.GSSAPIBindRequest{ServicePrincipalName: spn})
+	})
+	if err != nil {
+		//a failed bind leaves the connection anonymous
+		c.setBound("")
+		return fmt.Errorf("Bind error (%s): %w", principal, err)
+	}
+
+	if gc.layer != nil {
+		c.sasl.install(gc.layer, gc.maxBuffer)
+	}
+
+	c.setBound(principal)
+	return nil
+}
+
+//GSSAPIBindContext is like GSSAPIBind but the bind is aborted if ctx is done.
+func (c *Conn) GSSAPIBindContext(ctx context.Context) error {
+	return c.WithContext(ctx).GSSAPIBind()
+}
+
+//krb5Client implements ldap.GSSAPIClient. It negotiates the security layer allowed by protection (RFC 4752).
+type krb5Client struct {
+	client     *client.Client
+	protection SASLProtection
+	//layers is false if the connection can't install a security layer
+	layers bool
+
+	key    types.EncryptionKey
+	subkey types.EncryptionKey
+	//sendSeq and recvSeq are the initiator's and the acceptor's initial sequence numbers
+	sendSeq uint64
+	recvSeq uint64
+
+	//layer is the negotiated security layer, or nil if none was selected
+	layer     *krb5Layer
+	maxBuffer int
+}
+
+//InitSecContext implements ldap.GSSAPIClient.
+func (g *krb5Client) InitSecContext(target string, token []byte) ([]byte, bool, error) {
+	if token == nil {
+		tkt, key, err := g.client.GetServiceTicket(target)
+		if err != nil {
+			return nil, false, err
+		}
+		g.key = key
+
+		gssFlags := []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf, gssapi.ContextFlagMutual}
+		req, err := spnego.NewKRB5TokenAPREQ(g.client, tkt, key, gssFlags, []int{flags.APOptionMutualRequired})
+		if err != nil {
+			return nil, false, err
+		}
+
+		//wrap tokens are numbered from the authenticator's sequence number
+		if err = req.APReq.DecryptAuthenticator(key); err != nil {
+			return nil, false, err
+		}
+		g.sendSeq = uint64(req.APReq.Authenticator.SeqNumber)
+
+		buf, err := req.Marshal()
+		if err != nil {
+			return nil, false, err
+		}
+
+		return buf, true, nil
+	}
+
+	var rep spnego.KRB5Token
+	if err := rep.Unmarshal(token); err != nil {
+		return nil, false, err
+	}
+
+	if rep.IsKRBError() {
+		return nil, false, rep.KRBError
+	}
+
+	if !rep.IsAPRep() {
+		return nil, false, errors.New("expected AP-REP token")
+	}
+
+	encPart, err := crypto.DecryptEncPart(rep.APRep.EncPart, g.key, keyusage.AP_REP_ENCPART)
+	if err != nil {
+		return nil, false, err
+	}
+
+	part := new(messages.EncAPRepPart)
+	if err = part.Unmarshal(encPart); err != nil {
+		return nil, false, err
+	}
+	g.subkey = part.Subkey
+	//the acceptor numbers its wrap tokens from the AP-REP's sequence number, or 0 if it didn't send one
+	g.recvSeq = uint64(part.SequenceNumber)
+
+	return []byte{}, false, nil
+}
+
+//NegotiateSaslAuth implements ldap.GSSAPIClient. It selects a security layer from the layers the server offers.
+func (g *krb5Client) NegotiateSaslAuth(token []byte, authzid string) ([]byte, error) {
+	layer, err := newKRB5Layer(g.key, g.subkey, g.sendSeq, g.recvSeq, false)
+	if err != nil {
+		return nil, err
+	}
+
+	offer, err := layer.Unwrap(token)
+	if err != nil {
+		return nil, err
+	}
+	if len(offer) != 4 {
+		return nil, errors.New("invalid security layer offer")
+	}
+
+	selected, err := chooseLayer(g.protection, offer[0], g.layers)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := make([]byte, 4, 4+len(authzid))
+	reply[0] = selected
+	if selected != saslLayerNone {
+		reply[1], reply[2], reply[3] = 0xFF, 0xFF, 0xFF
+	}
+	reply = append(reply, authzid...)
+
+	//the reply is always signed, not sealed
+	buf, err := layer.Wrap(reply)
+	if err != nil {
+		return nil, err
+	}
+
+	if selected != saslLayerNone {
+		layer.seal = selected == saslLayerConfidentiality
+		g.layer = layer
+		g.maxBuffer = int(offer[1])<<16 | int(offer[2])<<8 | int(offer[3])
+	}
+
+	return buf, nil
+}
+
+//DeleteSecContext implements ldap.GSSAPIClient. The negotiated security layer keeps its own copy of the key.
+func (g *krb5Client) DeleteSecContext() error {
+	g.key = types.EncryptionKey{}
+	g.subkey = types.EncryptionKey{}
+	return nil
+}
+
+//Wrap token flags (RFC 4121 section 4.2.2)
+const (
+	wrapFlagSentByAcceptor byte = 0x01
+	wrapFlagSealed         byte = 0x02
+	wrapFlagAcceptorSubkey byte = 0x04
+)
+
+//wrapHeaderLen is the length of a Wrap token header (RFC 4121 section 4.2.6.2).
+const wrapHeaderLen = 16
+
+//krb5Layer implements securityLayer with Kerberos Wrap tokens (RFC 4121 section 4.2.6.2).
+type krb5Layer struct {
+	key      types.EncryptionKey
+	etype    etype.EType
+	acceptor bool
+	subkey   bool
+	seal     bool
+	sendSeq  uint64
+	recvSeq  uint64
+}
+
+//newKRB5Layer returns a layer that protects traffic with the acceptor's subkey, if there is one, or the session key.
+//sendSeq and recvSeq are the sequence numbers of the first tokens sent and received. Only the AES encryption types are supported.
+func newKRB5Layer(key, subkey types.EncryptionKey, sendSeq, recvSeq uint64, acceptor bool) (*krb5Layer, error) {
+	l := &krb5Layer{key: key, acceptor: acceptor, sendSeq: sendSeq, recvSeq: recvSeq}
+	if len(subkey.KeyValue) != 0 {
+		l.key, l.subkey = subkey, true
+	}
+
+	switch l.key.KeyType {
+	case etypeID.AES128_CTS_HMAC_SHA1_96, etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.AES128_CTS_HMAC_SHA256_128, etypeID.AES256_CTS_HMAC_SHA384_192:
+	default:
+		return nil, fmt.Errorf("unsupported session key encryption type %d: GSSAPI binds require an AES session key", l.key.KeyType)
+	}
+
+	e, err := crypto.GetEtype(l.key.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	l.etype = e
+
+	return l, nil
+}
+
+//usages returns the key usages for tokens sent and received by the layer.
+func (l *krb5Layer) usages() (send, recv uint32) {
+	if l.acceptor {
+		return keyusage.GSSAPI_ACCEPTOR_SEAL, keyusage.GSSAPI_INITIATOR_SEAL
+	}
+	return keyusage.GSSAPI_INITIATOR_SEAL, keyusage.GSSAPI_ACCEPTOR_SEAL
+}
+
+//Wrap returns p as a Wrap token, sealed if l.seal is set and otherwise signed.
+func (l *krb5Layer) Wrap(p []byte) ([]byte, error) {
+	send, _ := l.usages()
+
+	header := make([]byte, wrapHeaderLen)
+	header[0], header[1] = 0x05, 0x04
+	if l.acceptor {
+		header[2] |= wrapFlagSentByAcceptor
+	}
+	if l.subkey {
+		header[2] |= wrapFlagAcceptorSubkey
+	}
+	header[3] = 0xFF
+	binary.BigEndian.PutUint64(header[8:], l.sendSeq)
+	l.sendSeq++
+
+	if l.seal {
+		header[2] |= wrapFlagSealed
+		//AES needs no padding, so EC and RRC are zero in both the encrypted and plaintext headers
+		_, ciphertext, err := l.etype.EncryptMessage(l.key.KeyValue, concatBytes(p, header), send)
+		if err != nil {
+			return nil, err
+		}
+		return concatBytes(header, ciphertext), nil
+	}
+
+	//the checksum covers the plaintext and the header with EC and RRC set to zero
+	checksum, err := l.etype.GetChecksumHash(l.key.KeyValue, concatBytes(p, header), send)
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint16(header[4:], uint16(len(checksum)))
+
+	return concatBytes(header, p, checksum), nil
+}
+
+//Unwrap verifies a Wrap token from the other side of the context and returns its plaintext.
+//Tokens must arrive in order, so replayed or dropped tokens are rejected.
+func (l *krb5Layer) Unwrap(token []byte) ([]byte, error) {
+	_, recv := l.usages()
+
+	if len(token) < wrapHeaderLen || token[0] != 0x05 || token[1] != 0x04 || token[3] != 0xFF {
+		return nil, errors.New("invalid wrap token")
+	}
+
+	tokenFlags := token[2]
+	if (tokenFlags&wrapFlagSentByAcceptor != 0) == l.acceptor {
+		return nil, errors.New("wrap token sent in wrong direction")
+	}
+	if (tokenFlags&wrapFlagAcceptorSubkey != 0) != l.subkey {
+		return nil, errors.New("wrap token uses wrong key")
+	}
+	if seq := binary.BigEndian.Uint64(token[8:wrapHeaderLen]); seq != l.recvSeq {
+		return nil, fmt.Errorf("unexpected wrap token sequence number %d (expected %d)", seq, l.recvSeq)
+	}
+
+	ec := int(binary.BigEndian.Uint16(token[4:6]))
+	rrc := int(binary.BigEndian.Uint16(token[6:8]))
+
+	//undo the rotation of the data after the header
+	data := make([]byte, len(token)-wrapHeaderLen)
+	if len(data) > 0 {
+		rrc %= len(data)
+		copy(data, token[wrapHeaderLen+rrc:])
+		copy(data[len(data)-rrc:], token[wrapHeaderLen:wrapHeaderLen+rrc])
+	}
+
+	if tokenFlags&wrapFlagSealed == 0 {
+		if len(data) < ec {
+			return nil, errors.New("invalid wrap token")
+		}
+		p, checksum := data[:len(data)-ec], data[len(data)-ec:]
+
+		header := make([]byte, wrapHeaderLen)
+		copy(header, token[:4])
+		copy(header[8:], token[8:wrapHeaderLen])
+
+		expected, err := l.etype.GetChecksumHash(l.key.KeyValue, concatBytes(p, header), recv)
+		if err != nil {
+			return nil, err
+		}
+		if !hmac.Equal(expected, checksum) {
+			return nil, errors.New("wrap token checksum mismatch")
+		}
+
+		l.recvSeq++
+		return p, nil
+	}
+
+	if len(data) < l.etype.GetConfounderByteSize()+l.etype.GetHMACBitLength()/8 {
+		return nil, errors.New("invalid wrap token")
+	}
+
+	plaintext, err := l.etype.DecryptMessage(l.key.KeyValue, data, recv)
+	if err != nil {
+		return nil, err
+	}
+	if len(plaintext) < ec+wrapHeaderLen {
+		return nil, errors.New("invalid wrap token")
+	}
+
+	//the encrypted header must match the token's header, except RRC which is zero
+	inner := plaintext[len(plaintext)-wrapHeaderLen:]
+	if !bytes.Equal(inner[:6], token[:6]) || inner[6] != 0 || inner[7] != 0 || !bytes.Equal(inner[8:], token[8:wrapHeaderLen]) {
+		return nil, errors.New("wrap token header mismatch")
+	}
+
+	l.recvSeq++
+	return plaintext[:len(plaintext)-wrapHeaderLen-ec], nil
+}
+
+//concatBytes returns a new slice holding the given slices in order.
+func concatBytes(slices ...[]byte) []byte {
+	n := 0
+	for _, s := range slices {
+		n += len(s)
+	}
+
+	buf := make([]byte, 0, n)
+	for _, s := range slices {
+		buf = append(buf, s...)
+	}
+
+	return buf
+}
@@ -0,0 +1,355 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	krb5gssapi "github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+func testKRB5Key(t *testing.T, keyType int32) types.EncryptionKey {
+	e, err := crypto.GetEtype(keyType)
+	if err != nil {
+		t.Fatal("GetEtype: expected err to be nil but got:", err)
+	}
+	size := e.GetKeyByteSize()
+	//gokrb5 reports the seed size instead of the key size for aes256-cts-hmac-sha384-192
+	if keyType == etypeID.AES256_CTS_HMAC_SHA384_192 {
+		size = 32
+	}
+	key := types.EncryptionKey{KeyType: keyType, KeyValue: make([]byte, size)}
+	if _, err = rand.Read(key.KeyValue); err != nil {
+		t.Fatal("rand: expected err to be nil but got:", err)
+	}
+	return key
+}
+
+//testKRB5Layers returns an initiator and acceptor layer sharing a context.
+func testKRB5Layers(t *testing.T, keyType int32, subkey bool) (*krb5Layer, *krb5Layer) {
+	key := testKRB5Key(t, keyType)
+	var sub types.EncryptionKey
+	if subkey {
+		sub = testKRB5Key(t, keyType)
+	}
+
+	initiator, err := newKRB5Layer(key, sub, 100, 200, false)
+	if err != nil {
+		t.Fatal("newKRB5Layer: expected err to be nil but got:", err)
+	}
+	acceptor, err := newKRB5Layer(key, sub, 200, 100, true)
+	if err != nil {
+		t.Fatal("newKRB5Layer: expected err to be nil but got:", err)
+	}
+	return initiator, acceptor
+}
+
+func TestKRB5Layer(t *testing.T) {
+	keyTypes := []int32{
+		etypeID.AES128_CTS_HMAC_SHA1_96,
+		etypeID.AES256_CTS_HMAC_SHA1_96,
+		etypeID.AES128_CTS_HMAC_SHA256_128,
+		etypeID.AES256_CTS_HMAC_SHA384_192,
+	}
+	payloads := [][]byte{{}, []byte("a"), []byte("an LDAP message that is longer than one AES block")}
+
+	for _, keyType := range keyTypes {
+		for _, subkey := range []bool{false, true} {
+			for _, seal := range []bool{false, true} {
+				initiator, acceptor := testKRB5Layers(t, keyType, subkey)
+				initiator.seal, acceptor.seal = seal, seal
+
+				for _, p := range payloads {
+					token, err := initiator.Wrap(p)
+					if err != nil {
+						t.Fatalf("%d/%v/%v: Wrap: expected err to be nil but got: %v", keyType, subkey, seal, err)
+					}
+					if seal && len(p) > 1 && bytes.Contains(token, p) {
+						t.Errorf("%d/%v/%v: Wrap: expected sealed token not to contain plaintext", keyType, subkey, seal)
+					}
+					if out, err := acceptor.Unwrap(token); err != nil || !bytes.Equal(out, p) {
+						t.Errorf("%d/%v/%v: Unwrap: expected %q but got: %q, %v", keyType, subkey, seal, p, out, err)
+					}
+
+					reply, err := acceptor.Wrap(p)
+					if err != nil {
+						t.Fatalf("%d/%v/%v: Wrap: expected err to be nil but got: %v", keyType, subkey, seal, err)
+					}
+					if out, err := initiator.Unwrap(reply); err != nil || !bytes.Equal(out, p) {
+						t.Errorf("%d/%v/%v: Unwrap reply: expected %q but got: %q, %v", keyType, subkey, seal, p, out, err)
+					}
+
+					//tokens can't be reflected back to their sender
+					if _, err = initiator.Unwrap(token); err == nil {
+						t.Errorf("%d/%v/%v: Unwrap own token: expected error", keyType, subkey, seal)
+					}
+				}
+
+				token, err := initiator.Wrap(payloads[2])
+				if err != nil {
+					t.Fatalf("%d/%v/%v: Wrap: expected err to be nil but got: %v", keyType, subkey, seal, err)
+				}
+
+				//the data after the header may be rotated by the sender
+				rrc := 5
+				rotated := append([]byte{}, token[:wrapHeaderLen]...)
+				rotated = append(rotated, token[len(token)-rrc:]...)
+				rotated = append(rotated, token[wrapHeaderLen:len(token)-rrc]...)
+				binary.BigEndian.PutUint16(rotated[6:8], uint16(rrc))
+				if out, err := acceptor.Unwrap(rotated); err != nil || !bytes.Equal(out, payloads[2]) {
+					t.Errorf("%d/%v/%v: Unwrap rotated: expected %q but got: %q, %v", keyType, subkey, seal, payloads[2], out, err)
+				}
+
+				if token, err = initiator.Wrap(payloads[2]); err != nil {
+					t.Fatalf("%d/%v/%v: Wrap: expected err to be nil but got: %v", keyType, subkey, seal, err)
+				}
+
+				tampered := append([]byte{}, token...)
+				tampered[wrapHeaderLen+1] ^= 0x01
+				if _, err = acceptor.Unwrap(tampered); err == nil {
+					t.Errorf("%d/%v/%v: Unwrap tampered: expected error", keyType, subkey, seal)
+				}
+
+				tampered = append([]byte{}, token...)
+				tampered[15] ^= 0x01
+				if _, err = acceptor.Unwrap(tampered); err == nil {
+					t.Errorf("%d/%v/%v: Unwrap tampered header: expected error", keyType, subkey, seal)
+				}
+
+				if _, err = acceptor.Unwrap(token[:wrapHeaderLen+2]); err == nil {
+					t.Errorf("%d/%v/%v: Unwrap truncated: expected error", keyType, subkey, seal)
+				}
+
+				//rejected tokens don't advance the sequence number, but a token can only be accepted once
+				if out, err := acceptor.Unwrap(token); err != nil || !bytes.Equal(out, payloads[2]) {
+					t.Errorf("%d/%v/%v: Unwrap after rejected tokens: expected %q but got: %q, %v", keyType, subkey, seal, payloads[2], out, err)
+				}
+				if _, err = acceptor.Unwrap(token); err == nil {
+					t.Errorf("%d/%v/%v: Unwrap replayed: expected error", keyType, subkey, seal)
+				}
+
+				//a token is rejected if an earlier one was dropped
+				initiator.Wrap(payloads[1])
+				if token, err = initiator.Wrap(payloads[1]); err != nil {
+					t.Fatalf("%d/%v/%v: Wrap: expected err to be nil but got: %v", keyType, subkey, seal, err)
+				}
+				if _, err = acceptor.Unwrap(token); err == nil {
+					t.Errorf("%d/%v/%v: Unwrap out of order: expected error", keyType, subkey, seal)
+				}
+			}
+		}
+	}
+
+	if _, err := newKRB5Layer(types.EncryptionKey{KeyType: etypeID.RC4_HMAC, KeyValue: make([]byte, 16)}, types.EncryptionKey{}, 0, 0, false); err == nil {
+		t.Error("RC4: expected unsupported encryption type error")
+	}
+}
+
+func TestKRB5LayerCompatibility(t *testing.T) {
+	initiator, acceptor := testKRB5Layers(t, etypeID.AES256_CTS_HMAC_SHA1_96, true)
+
+	//signed tokens must be understood by gokrb5's implementation
+	token, err := initiator.Wrap([]byte("payload"))
+	if err != nil {
+		t.Fatal("Wrap: expected err to be nil but got:", err)
+	}
+
+	wt := new(krb5gssapi.WrapToken)
+	if err = wt.Unmarshal(token, false); err != nil {
+		t.Fatal("WrapToken.Unmarshal: expected err to be nil but got:", err)
+	}
+	if ok, err := wt.Verify(initiator.key, keyusage.GSSAPI_INITIATOR_SEAL); !ok || err != nil {
+		t.Error("WrapToken.Verify: expected token to verify but got:", err)
+	}
+	if string(wt.Payload) != "payload" || wt.SndSeqNum != 100 {
+		t.Errorf("WrapToken: expected payload and sequence number to match but got: %q, %d", wt.Payload, wt.SndSeqNum)
+	}
+
+	wt = &krb5gssapi.WrapToken{Flags: wrapFlagSentByAcceptor | wrapFlagAcceptorSubkey, EC: 12, SndSeqNum: 200, Payload: []byte("reply")}
+	if err = wt.SetCheckSum(acceptor.key, keyusage.GSSAPI_ACCEPTOR_SEAL); err != nil {
+		t.Fatal("WrapToken.SetCheckSum: expected err to be nil but got:", err)
+	}
+	if token, err = wt.Marshal(); err != nil {
+		t.Fatal("WrapToken.Marshal: expected err to be nil but got:", err)
+	}
+	if out, err := initiator.Unwrap(token); err != nil || string(out) != "reply" {
+		t.Errorf("Unwrap: expected %q but got: %q, %v", "reply", out, err)
+	}
+}
+
+func TestChooseLayer(t *testing.T) {
+	all := saslLayerNone | saslLayerIntegrity | saslLayerConfidentiality
+
+	tests := []struct {
+		protection SASLProtection
+		offered    byte
+		available  bool
+		layer      byte
+		err        bool
+	}{
+		{ProtectionAuto, all, true, saslLayerConfidentiality, false},
+		{ProtectionAuto, saslLayerNone | saslLayerIntegrity, true, saslLayerIntegrity, false},
+		{ProtectionAuto, all, false, saslLayerNone, false},
+		{ProtectionAuto, saslLayerIntegrity, false, 0, true},
+		{ProtectionNone, all, true, saslLayerNone, false},
+		{ProtectionNone, saslLayerIntegrity, true, 0, true},
+		{ProtectionSign, all, true, saslLayerIntegrity, false},
+		{ProtectionSign, all, false, 0, true},
+		{ProtectionSeal, all, true, saslLayerConfidentiality, false},
+		{ProtectionSeal, saslLayerNone | saslLayerIntegrity, true, 0, true},
+		{SASLProtection(-1), all, true, 0, true},
+	}
+
+	for _, test := range tests {
+		layer, err := chooseLayer(test.protection, test.offered, test.available)
+		if (err != nil) != test.err || layer != test.layer {
+			t.Errorf("chooseLayer(%d, %#x, %v): expected %#x, error %v but got: %#x, %v",
+				test.protection, test.offered, test.available, test.layer, test.err, layer, err)
+		}
+	}
+}
+
+func TestSASLConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	conn := newSASLConn(client)
+	initiator, acceptor := testKRB5Layers(t, etypeID.AES256_CTS_HMAC_SHA1_96, true)
+	initiator.seal, acceptor.seal = true, true
+
+	//traffic passes through without being parsed until a bind is sent or a layer is installed
+	plain := []byte("plain")
+	go server.Write(plain)
+	buf := make([]byte, 64)
+	if n, err := conn.Read(buf); err != nil || !bytes.Equal(buf[:n], plain) {
+		t.Fatalf("Read: expected %x but got: %x, %v", plain, buf[:n], err)
+	}
+
+	//a Read waiting when the layer is installed must unwrap what arrives
+	type result struct {
+		data string
+		err  error
+	}
+	read := make(chan result)
+	go func() {
+		var data []byte
+		buf := make([]byte, 4)
+		for len(data) < 12 {
+			n, err := conn.Read(buf)
+			if err != nil {
+				read <- result{string(data), err}
+				return
+			}
+			data = append(data, buf[:n]...)
+		}
+		read <- result{string(data), nil}
+	}()
+
+	conn.install(initiator, 10+saslWrapOverhead)
+
+	token, err := acceptor.Wrap([]byte("sealed reply"))
+	if err != nil {
+		t.Fatal("Wrap: expected err to be nil but got:", err)
+	}
+	frame := make([]byte, 4+len(token))
+	binary.BigEndian.PutUint32(frame, uint32(len(token)))
+	copy(frame[4:], token)
+	go server.Write(frame)
+
+	if r := <-read; r.err != nil || r.data != "sealed reply" {
+		t.Errorf("Read: expected %q but got: %q, %v", "sealed reply", r.data, r.err)
+	}
+
+	//writes are split into buffers the server accepts
+	go func() {
+		if _, err := conn.Write([]byte("a request longer than ten bytes")); err != nil {
+			t.Error("Write: expected err to be nil but got:", err)
+		}
+	}()
+
+	var received []byte
+	for len(received) < 31 {
+		var size [4]byte
+		if _, err = server.Read(size[:]); err != nil {
+			t.Fatal("Read size: expected err to be nil but got:", err)
+		}
+		token := make([]byte, binary.BigEndian.Uint32(size[:]))
+		for n := 0; n < len(token); {
+			m, err := server.Read(token[n:])
+			if err != nil {
+				t.Fatal("Read token: expected err to be nil but got:", err)
+			}
+			n += m
+		}
+
+		p, err := acceptor.Unwrap(token)
+		if err != nil {
+			t.Fatal("Unwrap: expected err to be nil but got:", err)
+		}
+		if len(p) > 10 {
+			t.Errorf("Write: expected buffers of at most 10 bytes but got %d", len(p))
+		}
+		received = append(received, p...)
+	}
+
+	if string(received) != "a request longer than ten bytes" {
+		t.Errorf("Write: expected %q but got: %q", "a request longer than ten bytes", received)
+	}
+}
+
+func TestConnGSSAPIBind(t *testing.T) {
+	if testConfig.Server == "" {
+		t.Skip("ADTEST_SERVER not set")
+		return
+	}
+
+	if os.Getenv("ADTEST_KRB5_KEYTAB") == "" || os.Getenv("ADTEST_KRB5_USERNAME") == "" {
+		t.Skip("ADTEST_KRB5_KEYTAB or ADTEST_KRB5_USERNAME not set")
+		return
+	}
+
+	for _, protection := range []SASLProtection{ProtectionNone, ProtectionSign, ProtectionSeal} {
+		config := &Config{Server: testConfig.Server, Port: testConfig.Port, Security: SecurityNone, BaseDN: testConfig.BaseDN}
+		config.Kerberos = &KerberosConfig{
+			Krb5Conf:   os.Getenv("ADTEST_KRB5_CONF"),
+			Keytab:     os.Getenv("ADTEST_KRB5_KEYTAB"),
+			Username:   os.Getenv("ADTEST_KRB5_USERNAME"),
+			SPN:        os.Getenv("ADTEST_KRB5_SPN"),
+			Protection: protection,
+		}
+
+		conn, err := config.Connect()
+		if err != nil {
+			t.Fatal("Error connecting to server:", err)
+		}
+
+		if err = conn.GSSAPIBind(); err != nil {
+			conn.Conn.Close()
+			t.Fatalf("Protection %d: expected err to be nil but got: %v", protection, err)
+		}
+
+		if conn.boundAs() == "" {
+			t.Errorf("Protection %d: expected connection to be bound", protection)
+		}
+
+		//requests after the bind go through the security layer
+		result, err := conn.Conn.WhoAmI(nil)
+		if err != nil || result.AuthzID == "" {
+			t.Errorf("Protection %d: WhoAmI: expected authzid but got: %v, %v", protection, result, err)
+		}
+
+		if err = conn.GSSAPIBind(); protection != ProtectionNone && err == nil {
+			t.Errorf("Protection %d: expected rebind error", protection)
+		}
+
+		conn.Conn.Close()
+	}
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+//MemberFilter specifies which kinds of objects GroupMembers returns. Filters can be combined, e.g. MemberUsers|MemberComputers.
+type MemberFilter int
+
+//MemberFilters understood by GroupMembers. A MemberFilter of 0 returns all members, including contacts and foreign security principals.
+const (
+	MemberUsers MemberFilter = 1 << iota
+	MemberComputers
+	MemberGroups
+)
+
+//memberClass returns the MemberFilter matching the objectClass values of entry, or 0 if none match.
+func memberClass(entry *ldap.Entry) MemberFilter {
+	var class MemberFilter
+	for _, c := range entry.GetAttributeValues("objectClass") {
+		switch strings.ToLower(c) {
+		case "computer":
+			return MemberComputers
+		case "group":
+			return MemberGroups
+		case "user":
+			class = MemberUsers
+		}
+	}
+	return class
+}
+
+//GroupMembers returns the DNs of the members of the given group (referenced by DN or cn) or an error if one occurred.
+//If recursive is true, the members of nested groups are returned as well; nesting cycles are only followed once.
+//Objects whose primary group is the group are included. filter limits the kinds of members returned (see MemberFilter).
+//Members outside of Config.BaseDN can't be classified, so they are only returned if filter is 0.
+func (c *Conn) GroupMembers(group string, recursive bool, filter MemberFilter) ([]string, error) {
+	groupDN, err := c.GroupDN(group)
+	if err != nil {
+		return nil, err
+	}
+
+	var members []string
+	seen := map[string]bool{strings.ToLower(groupDN): true}
+	visited := map[string]bool{strings.ToLower(groupDN): true}
+	queue := []string{groupDN}
+
+	for len(queue) > 0 {
+		dn := queue[0]
+		queue = queue[1:]
+
+		classes, err := c.groupMembers(dn)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, member := range classes {
+			key := strings.ToLower(member.DN)
+			class := memberClass(member)
+
+			if recursive && class == MemberGroups && !visited[key] {
+				visited[key] = true
+				queue = append(queue, member.DN)
+			}
+
+			if seen[key] || (filter != 0 && filter&class == 0) {
+				continue
+			}
+			seen[key] = true
+			members = append(members, member.DN)
+		}
+	}
+
+	return members, nil
+}
+
+//groupMembers returns the direct members of the group with the given DN, with their objectClass if they are under Config.BaseDN,
+//or an error if one occurred.
+func (c *Conn) groupMembers(dn string) ([]*ldap.Entry, error) {
+	entry, err := c.getEntry(dn, []string{"objectSid"})
+	if err != nil {
+		return nil, err
+	}
+
+	dns, err := c.rangeValues(dn, "member")
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := c.classify(dns)
+	if err != nil {
+		return nil, err
+	}
+
+	//members whose primary group is this group aren't listed in the member attribute
+	sid := new(SID)
+	if err = sid.UnmarshalBinary(entry.GetRawAttributeValue("objectSid")); err != nil {
+		return nil, fmt.Errorf("Parse error: invalid objectSid: %w", err)
+	}
+
+	primary, err := c.Search(fmt.Sprintf("(primaryGroupID=%d)", sid.RID()), []string{"objectClass"}, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(members, primary...), nil
+}
+
+//rangeValues returns all values of attr for the entry with the given DN, using range retrieval (e.g. "member;range=0-1499")
+//to get past the server's MaxValRange limit, or an error if one occurred.
+func (c *Conn) rangeValues(dn, attr string) ([]string, error) {
+	var values []string
+	start := 0
+	for {
+		entry, err := c.getEntry(dn, []string{fmt.Sprintf("%s;range=%d-*", attr, start)})
+		if err != nil {
+			return nil, err
+		}
+
+		var ranged *ldap.EntryAttribute
+		for _, a := range entry.Attributes {
+			if strings.EqualFold(a.Name, attr) || strings.HasPrefix(strings.ToLower(a.Name), strings.ToLower(attr)+";range=") {
+				ranged = a
+				break
+			}
+		}
+		if ranged == nil {
+			return values, nil
+		}
+
+		values = append(values, ranged.Values...)
+
+		end, err := parseRangeEnd(ranged.Name)
+		if err != nil {
+			return nil, err
+		}
+		if end == -1 {
+			return values, nil
+		}
+		start = end + 1
+	}
+}
+
+//parseRangeEnd returns the end of the range in a ranged attribute name, e.g. 1499 for "member;range=0-1499",
+//or -1 if the range is the last one ("member;range=1500-*") or the name has no range.
+func parseRangeEnd(name string) (int, error) {
+	idx := strings.Index(strings.ToLower(name), ";range=")
+	if idx == -1 {
+		return -1, nil
+	}
+
+	bounds := strings.SplitN(name[idx+len(";range="):], "-", 2)
+	if len(bounds) != 2 {
+		return 0, fmt.Errorf(`Parse error: invalid range "%s"`, name)
+	}
+	if bounds[1] == "*" {
+		return -1, nil
+	}
+
+	end, err := strconv.Atoi(bounds[1])
+	if err != nil {
+		return 0, fmt.Errorf(`Parse error: invalid range "%s": %w`, name, err)
+	}
+
+	return end, nil
+}
+
+//classify returns entries with the objectClass attribute for the given DNs, searched in batches.
+//DNs that can't be found under Config.BaseDN are returned without attributes.
+func (c *Conn) classify(dns []string) ([]*ldap.Entry, error) {
+	found := make(map[string]*ldap.Entry, len(dns))
+	for start := 0; start < len(dns); start += filterBatchSize {
+		end := start + filterBatchSize
+		if end > len(dns) {
+			end = len(dns)
+		}
+
+		var filter strings.Builder
+		filter.WriteString("(|")
+		for _, dn := range dns[start:end] {
+			filter.WriteString(fmt.Sprintf("(distinguishedName=%s)", ldap.EscapeFilter(dn)))
+		}
+		filter.WriteString(")")
+
+		entries, err := c.Search(filter.String(), []string{"objectClass"}, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			found[strings.ToLower(entry.DN)] = entry
+		}
+	}
+
+	entries := make([]*ldap.Entry, len(dns))
+	for idx, dn := range dns {
+		if entry, ok := found[strings.ToLower(dn)]; ok {
+			entries[idx] = entry
+		} else {
+			entries[idx] = ldap.NewEntry(dn, nil)
+		}
+	}
+
+	return entries, nil
+}
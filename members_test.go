@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"testing"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+func TestParseRangeEnd(t *testing.T) {
+	tests := map[string]int{
+		"member":                 -1,
+		"member;range=0-*":       -1,
+		"member;range=1500-*":    -1,
+		"member;range=0-1499":    1499,
+		"Member;Range=1500-2999": 2999,
+	}
+
+	for name, want := range tests {
+		have, err := parseRangeEnd(name)
+		if err != nil {
+			t.Errorf("could not parse %s: %v", name, err)
+			continue
+		}
+		if have != want {
+			t.Errorf("expected range end of %s to be equal: want: %d, have: %d", name, want, have)
+		}
+	}
+
+	for _, name := range []string{"member;range=0", "member;range=0-abc"} {
+		if _, err := parseRangeEnd(name); err == nil {
+			t.Errorf("expected %s to fail", name)
+		}
+	}
+}
+
+func TestMemberClass(t *testing.T) {
+	tests := []struct {
+		classes []string
+		class   MemberFilter
+	}{
+		{[]string{"top", "person", "organizationalPerson", "user"}, MemberUsers},
+		{[]string{"top", "person", "organizationalPerson", "user", "computer"}, MemberComputers},
+		{[]string{"top", "group"}, MemberGroups},
+		{[]string{"top", "person", "organizationalPerson", "contact"}, 0},
+		{nil, 0},
+	}
+
+	for _, test := range tests {
+		entry := ldap.NewEntry("CN=Test,DC=example,DC=com", map[string][]string{"objectClass": test.classes})
+		if class := memberClass(entry); class != test.class {
+			t.Errorf("expected class of %v to be equal: want: %d, have: %d", test.classes, test.class, class)
+		}
+	}
+}
+
+func TestConnGroupMembers(t *testing.T) {
+	if testConfig.Server == "" {
+		t.Skip("ADTEST_SERVER not set")
+		return
+	}
+
+	if testConfig.BindUPN == "" || testConfig.BindPass == "" {
+		t.Skip("ADTEST_BIND_UPN or ADTEST_BIND_PASS not set")
+		return
+	}
+
+	if testConfig.BaseDN == "" {
+		t.Skip("ADTEST_BASEDN not set")
+		return
+	}
+
+	config := &Config{Server: testConfig.Server, Port: testConfig.Port, Security: testConfig.BindSecurity, BaseDN: testConfig.BaseDN}
+	conn, err := config.Connect()
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Conn.Close()
+
+	status, err := conn.Bind(testConfig.BindUPN, testConfig.BindPass)
+	if err != nil {
+		t.Fatal("Error binding to server:", err)
+	}
+
+	if !status {
+		t.Fatal("Error binding to server: invalid credentials")
+	}
+
+	dn, err := conn.GetDN("userPrincipalName", testConfig.BindUPN)
+	if err != nil {
+		t.Fatal("Error getting user DN:", err)
+	}
+
+	primaryGroup, err := conn.ObjectPrimaryGroup("userPrincipalName", testConfig.BindUPN)
+	if err != nil {
+		t.Fatal("Error getting primary group:", err)
+	}
+
+	contains := func(dns []string, dn string) bool {
+		for _, d := range dns {
+			if d == dn {
+				return true
+			}
+		}
+		return false
+	}
+
+	members, err := conn.GroupMembers(primaryGroup, false, MemberUsers)
+	if err != nil {
+		t.Fatal("Primary group: Expected err to be nil but got:", err)
+	}
+
+	if !contains(members, dn) {
+		t.Errorf("Primary group: Expected user (%s) to be returned", dn)
+	}
+
+	members, err = conn.GroupMembers(primaryGroup, false, MemberGroups)
+	if err != nil {
+		t.Fatal("Primary group (groups): Expected err to be nil but got:", err)
+	}
+
+	if contains(members, dn) {
+		t.Errorf("Primary group (groups): Expected user (%s) to not be returned", dn)
+	}
+
+	entry, err := conn.GetAttributes("userPrincipalName", testConfig.BindUPN, []string{"memberOf"})
+	if err != nil {
+		t.Fatal("Error getting user groups:", err)
+	}
+
+	for _, group := range entry.GetAttributeValues("memberOf") {
+		members, err = conn.GroupMembers(group, true, 0)
+		if err != nil {
+			t.Fatalf("%s: Expected err to be nil but got: %v", group, err)
+		}
+
+		if !contains(members, dn) {
+			t.Errorf("%s: Expected user (%s) to be returned", group, dn)
+		}
+	}
+}
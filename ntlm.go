@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+)
+
+//NTLMBind authenticates the connection with NTLM and returns the result or an error if one occurred.
+//username may be the sAMAccountName, the userPrincipalName, or a down-level logon name (see ParseUsername).
+//If Config.DetailedErrors is set, invalid credentials are reported as a *BindError instead of false and a nil error.
+//NTLM binds don't sign or seal traffic, so domain controllers that require LDAP signing only accept them over
+//SecurityTLS or SecurityStartTLS; use DigestMD5Bind or GSSAPIBind on connections made with SecurityNone.
+func (c *Conn) NTLMBind(username, password string) (bool, error) {
+	if password == "" {
+		return c.rejectEmptyPassword()
+	}
+
+	domain, user := ntlmUser(username)
+	err := c.bindAs(username, func() error {
+		return c.Conn.NTLMBind(domain, user, password)
+	})
+
+	return c.bindResult(username, err)
+}
+
+//NTLMBindContext is like NTLMBind but the bind is aborted if ctx is done.
+func (c *Conn) NTLMBindContext(ctx context.Context, username, password string) (bool, error) {
+	return c.WithContext(ctx).NTLMBind(username, password)
+}
+
+//NTLMBindHash is like NTLMBind but authenticates with the account's NT hash, given as 32 hexadecimal characters,
+//instead of its password (pass-the-hash). This allows service accounts to bind without storing their password.
+//username must be the sAMAccountName or a down-level logon name; the domain is always taken from the server's challenge.
+func (c *Conn) NTLMBindHash(username, hash string) (bool, error) {
+	if b, err := hex.DecodeString(hash); err != nil || len(b) != 16 {
+		return false, fmt.Errorf("Bind error (%s): NT hash must be 32 hexadecimal characters", username)
+	}
+
+	u, err := ParseUsername(username)
+	if err != nil {
+		return false, fmt.Errorf("Bind error (%s): %w", username, err)
+	}
+	if u.Format == UsernameUPN {
+		return false, fmt.Errorf("Bind error (%s): NTLM hash binds require a sAMAccountName or down-level logon name", username)
+	}
+
+	err = c.bindAs(username, func() error {
+		return c.Conn.NTLMBindWithHash("", u.User, hash)
+	})
+
+	return c.bindResult(username, err)
+}
+
+//NTLMBindHashContext is like NTLMBindHash but the bind is aborted if ctx is done.
+func (c *Conn) NTLMBindHashContext(ctx context.Context, username, hash string) (bool, error) {
+	return c.WithContext(ctx).NTLMBindHash(username, hash)
+}
+
+//ntlmUser splits username into the domain and user sent in NTLM messages.
+//Down-level logon names are split into their parts; other usernames are sent as-is without a domain.
+func ntlmUser(username string) (domain, user string) {
+	if u, err := ParseUsername(username); err == nil && u.Format == UsernameDownLevel {
+		return u.Domain, u.User
+	}
+	return "", username
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestNTLMUser(t *testing.T) {
+	type test struct {
+		username string
+		domain   string
+		user     string
+	}
+
+	tests := []test{
+		{`CORP\jdoe`, "CORP", "jdoe"},
+		{"jdoe@CORP", "CORP", "jdoe"},
+		{"jdoe@corp.example.com", "", "jdoe@corp.example.com"},
+		{"jdoe", "", "jdoe"},
+	}
+
+	for _, test := range tests {
+		if domain, user := ntlmUser(test.username); domain != test.domain || user != test.user {
+			t.Errorf("%s: Expected %q, %q but got: %q, %q", test.username, test.domain, test.user, domain, user)
+		}
+	}
+}
+
+func TestConnNTLMBindHash(t *testing.T) {
+	conn := &Conn{Config: &Config{}}
+
+	for _, hash := range []string{"", "not hex", "31d6cfe0d16ae931b73c59d7e0c089"} {
+		if _, err := conn.NTLMBindHash(`CORP\jdoe`, hash); err == nil {
+			t.Errorf("Expected error for hash %q but got nil", hash)
+		}
+	}
+
+	if _, err := conn.NTLMBindHash("jdoe@corp.example.com", "31d6cfe0d16ae931b73c59d7e0c089c0"); err == nil {
+		t.Error("UPN: Expected error but got nil")
+	}
+}
+
+func TestConnNTLMBind(t *testing.T) {
+	if testConfig.Server == "" {
+		t.Skip("ADTEST_SERVER not set")
+		return
+	}
+
+	config := &Config{Server: testConfig.Server, Port: testConfig.Port, Security: testConfig.BindSecurity}
+	conn, err := config.Connect()
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Conn.Close()
+
+	if status, _ := conn.NTLMBind("test", ""); status {
+		t.Error("Empty password: Expected authentication status to be false")
+	}
+
+	if status, _ := conn.NTLMBind("go-ad-auth", "invalid_password"); status {
+		t.Error("Invalid credentials: Expected authentication status to be false")
+	}
+
+	if testConfig.BindUPN == "" || testConfig.BindPass == "" {
+		t.Skip("ADTEST_BIND_UPN or ADTEST_BIND_PASS not set")
+		return
+	}
+
+	if status, err := conn.NTLMBind(testConfig.BindUPN, testConfig.BindPass); !status || err != nil {
+		t.Error("Valid credentials: Expected authentication status to be true but got:", err)
+	}
+
+	config.DetailedErrors = true
+
+	var bindErr *BindError
+	if _, err = conn.NTLMBind(testConfig.BindUPN, "invalid_password"); !errors.As(err, &bindErr) {
+		t.Error("Detailed invalid credentials: Expected *BindError but got:", err)
+	}
+
+	hash := os.Getenv("ADTEST_BIND_NTHASH")
+	username := os.Getenv("ADTEST_BIND_SAM")
+	if hash == "" || username == "" {
+		t.Skip("ADTEST_BIND_NTHASH or ADTEST_BIND_SAM not set")
+		return
+	}
+
+	if status, err := conn.NTLMBindHash(username, hash); !status || err != nil {
+		t.Error("Valid hash: Expected authentication status to be true but got:", err)
+	}
+
+	if status, _ := conn.NTLMBindHash(username, "31d6cfe0d16ae931b73c59d7e0c089c0"); status {
+		t.Error("Invalid hash: Expected authentication status to be false")
+	}
+}
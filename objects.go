@@ -0,0 +1,75 @@
+package auth
+
+import "time"
+
+//User holds common attributes of an Active Directory user. It can be used with Conn.GetObject and Conn.SearchObjects:
+//
+//	user := new(auth.User)
+//	err := conn.GetObject("sAMAccountName", "jdoe", user)
+type User struct {
+	DN                 string             `ad:"dn"`
+	ObjectGUID         GUID               `ad:"objectGUID"`
+	ObjectSID          SID                `ad:"objectSid"`
+	SAMAccountName     string             `ad:"sAMAccountName"`
+	UserPrincipalName  string             `ad:"userPrincipalName"`
+	CN                 string             `ad:"cn"`
+	DisplayName        string             `ad:"displayName"`
+	GivenName          string             `ad:"givenName"`
+	Surname            string             `ad:"sn"`
+	Mail               string             `ad:"mail"`
+	Description        string             `ad:"description"`
+	EmployeeID         string             `ad:"employeeID"`
+	Title              string             `ad:"title"`
+	Department         string             `ad:"department"`
+	Manager            string             `ad:"manager"`
+	MemberOf           []string           `ad:"memberOf"`
+	PrimaryGroupID     int                `ad:"primaryGroupID"`
+	UserAccountControl UserAccountControl `ad:"userAccountControl"`
+	BadPwdCount        int                `ad:"badPwdCount"`
+	BadPasswordTime    time.Time          `ad:"badPasswordTime"`
+	LockoutTime        time.Time          `ad:"lockoutTime"`
+	PwdLastSet         time.Time          `ad:"pwdLastSet"`
+	AccountExpires     time.Time          `ad:"accountExpires"`
+	LastLogonTimestamp time.Time          `ad:"lastLogonTimestamp"`
+	WhenCreated        time.Time          `ad:"whenCreated"`
+	WhenChanged        time.Time          `ad:"whenChanged"`
+}
+
+//Group holds common attributes of an Active Directory group.
+type Group struct {
+	DN             string    `ad:"dn"`
+	ObjectGUID     GUID      `ad:"objectGUID"`
+	ObjectSID      SID       `ad:"objectSid"`
+	SAMAccountName string    `ad:"sAMAccountName"`
+	CN             string    `ad:"cn"`
+	DisplayName    string    `ad:"displayName"`
+	Description    string    `ad:"description"`
+	Mail           string    `ad:"mail"`
+	ManagedBy      string    `ad:"managedBy"`
+	GroupType      GroupType `ad:"groupType"`
+	Member         []string  `ad:"member"`
+	MemberOf       []string  `ad:"memberOf"`
+	WhenCreated    time.Time `ad:"whenCreated"`
+	WhenChanged    time.Time `ad:"whenChanged"`
+}
+
+//Computer holds common attributes of an Active Directory computer.
+type Computer struct {
+	DN                     string             `ad:"dn"`
+	ObjectGUID             GUID               `ad:"objectGUID"`
+	ObjectSID              SID                `ad:"objectSid"`
+	SAMAccountName         string             `ad:"sAMAccountName"`
+	CN                     string             `ad:"cn"`
+	DNSHostName            string             `ad:"dNSHostName"`
+	Description            string             `ad:"description"`
+	OperatingSystem        string             `ad:"operatingSystem"`
+	OperatingSystemVersion string             `ad:"operatingSystemVersion"`
+	ManagedBy              string             `ad:"managedBy"`
+	MemberOf               []string           `ad:"memberOf"`
+	PrimaryGroupID         int                `ad:"primaryGroupID"`
+	UserAccountControl     UserAccountControl `ad:"userAccountControl"`
+	PwdLastSet             time.Time          `ad:"pwdLastSet"`
+	LastLogonTimestamp     time.Time          `ad:"lastLogonTimestamp"`
+	WhenCreated            time.Time          `ad:"whenCreated"`
+	WhenChanged            time.Time          `ad:"whenChanged"`
+}
@@ -1,8 +1,10 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	ldap "github.com/go-ldap/ldap/v3"
 	"golang.org/x/text/encoding/unicode"
@@ -10,9 +12,9 @@ import (
 
 //ModifyDNPassword sets a new password for the given user or returns an error if one occurred.
 //ModifyDNPassword is used for resetting user passwords using administrative privileges.
+//If the password can't be set, the returned error wraps one of the password change reasons, e.g. ErrInsufficientRights.
 func (c *Conn) ModifyDNPassword(dn, newPasswd string) error {
-	utf16 := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
-	encoded, err := utf16.NewEncoder().String(fmt.Sprintf(`"%s"`, newPasswd))
+	encoded, err := encodePassword(newPasswd)
 	if err != nil {
 		return fmt.Errorf("Password error: Unable to encode password: %w", err)
 	}
@@ -20,9 +22,11 @@ func (c *Conn) ModifyDNPassword(dn, newPasswd string) error {
 	req := ldap.NewModifyRequest(dn, nil)
 	req.Replace("unicodePwd", []string{encoded})
 
-	err = c.Conn.Modify(req)
+	err = c.do(func() error {
+		return c.Conn.Modify(req)
+	})
 	if err != nil {
-		return fmt.Errorf("Password error: Unable to modify password: %w", err)
+		return fmt.Errorf("Password error: Unable to modify password: %w", newPasswordError(err, c.encrypted()))
 	}
 
 	return nil
@@ -30,51 +34,106 @@ func (c *Conn) ModifyDNPassword(dn, newPasswd string) error {
 
 //UpdatePassword checks if the given credentials are valid and updates the password if they are,
 //or returns an error if one occurred. UpdatePassword is used for users resetting their own password.
+//If the password can't be changed, the returned error wraps one of the password change reasons, e.g. ErrPasswordRestriction.
+//A wrong old password matches ErrWrongPassword; if Config.DetailedErrors is set, the error also wraps the *BindError.
 func UpdatePassword(config *Config, username, oldPasswd, newPasswd string) error {
-	utf16 := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
-	oldEncoded, err := utf16.NewEncoder().String(fmt.Sprintf(`"%s"`, oldPasswd))
+	return UpdatePasswordContext(context.Background(), config, username, oldPasswd, newPasswd)
+}
+
+//UpdatePasswordContext is like UpdatePassword but connecting, binding, searching and modifying are aborted if ctx is done.
+func UpdatePasswordContext(ctx context.Context, config *Config, username, oldPasswd, newPasswd string) error {
+	oldEncoded, err := encodePassword(oldPasswd)
 	if err != nil {
 		return fmt.Errorf("Password error: Unable to encode old password: %w", err)
 	}
 
-	newEncoded, err := utf16.NewEncoder().String(fmt.Sprintf(`"%s"`, newPasswd))
+	newEncoded, err := encodePassword(newPasswd)
 	if err != nil {
 		return fmt.Errorf("Password error: Unable to encode new password: %w", err)
 	}
 
-	upn, err := config.UPN(username)
-	if err != nil {
-		return err
+	conn, status, entry, err := authenticate(ctx, config, username, oldPasswd, true, []string{""})
+	var bindErr *BindError
+	if errors.As(err, &bindErr) && bindErr.Reason == ErrInvalidCredentials {
+		return &wrongPasswordError{err: bindErr}
 	}
-
-	conn, err := config.Connect()
-	if err != nil {
-		return err
-	}
-	defer conn.Conn.Close()
-
-	//bind
-	status, err := conn.Bind(upn, oldPasswd)
 	if err != nil {
 		return err
 	}
 	if !status {
-		return errors.New("Password error: credentials not valid")
-	}
-
-	dn, err := conn.GetDN("userPrincipalName", upn)
-	if err != nil {
-		return err
+		return fmt.Errorf("Password error: %w", ErrWrongPassword)
 	}
+	defer conn.Conn.Close()
 
-	req := ldap.NewModifyRequest(dn, nil)
+	req := ldap.NewModifyRequest(entry.DN, nil)
 	req.Delete("unicodePwd", []string{oldEncoded})
 	req.Add("unicodePwd", []string{newEncoded})
 
-	err = conn.Conn.Modify(req)
+	err = conn.do(func() error {
+		return conn.Conn.Modify(req)
+	})
 	if err != nil {
+		err = newPasswordError(err, conn.encrypted())
+		//Active Directory reports a password that is too young the same way as one that doesn't meet the policy
+		var perr *ModifyError
+		if errors.As(err, &perr) && perr.Reason == ErrPasswordRestriction && conn.passwordTooYoung(entry.DN) {
+			perr.Reason = ErrPasswordTooYoung
+		}
 		return fmt.Errorf("Password error: Unable to modify password: %w", err)
 	}
 
 	return nil
 }
+
+//wrongPasswordError is returned by UpdatePassword if Config.DetailedErrors is set and the old password is rejected.
+//It matches ErrWrongPassword, like the error returned without DetailedErrors, as well as the *BindError and its Reason.
+type wrongPasswordError struct {
+	err *BindError
+}
+
+func (e *wrongPasswordError) Error() string {
+	return fmt.Sprintf("Password error: %v: %v", ErrWrongPassword, e.err)
+}
+
+func (e *wrongPasswordError) Is(target error) bool {
+	return target == ErrWrongPassword
+}
+
+func (e *wrongPasswordError) Unwrap() error {
+	return e.err
+}
+
+//passwordTooYoung returns true if the password of the user with the given DN was set more recently than the minimum password age allows.
+//If the user's fine-grained password policy can't be read, the domain's policy is used.
+func (c *Conn) passwordTooYoung(dn string) bool {
+	policy, err := c.PasswordPolicy(dn)
+	if err != nil {
+		if policy, err = c.DomainPasswordPolicy(); err != nil {
+			return false
+		}
+	}
+
+	entry, err := c.getEntry(dn, []string{"pwdLastSet"})
+	if err != nil {
+		return false
+	}
+
+	lastSet, err := GetFileTime(entry, "pwdLastSet")
+	if err != nil || lastSet.IsZero() {
+		return false
+	}
+
+	return time.Since(lastSet) < policy.MinPasswordAge
+}
+
+//encrypted returns true if the connection uses TLS.
+func (c *Conn) encrypted() bool {
+	_, ok := c.Conn.TLSConnectionState()
+	return ok
+}
+
+//encodePassword encodes password for the unicodePwd attribute.
+func encodePassword(password string) (string, error) {
+	utf16 := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	return utf16.NewEncoder().String(fmt.Sprintf(`"%s"`, password))
+}
@@ -1,11 +1,16 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
+	"net"
 	"strings"
 	"testing"
 	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
 )
 
 func TestConnModifyDNPassword(t *testing.T) {
@@ -157,3 +162,50 @@ func TestUpdatePassword(t *testing.T) {
 		t.Fatal("Authenticate: Expected status to be true")
 	}
 }
+
+func TestUpdatePasswordWrongPassword(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error starting listener:", err)
+	}
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				packet, err := ber.ReadPacket(conn)
+				if err != nil || len(packet.Children) < 2 {
+					return
+				}
+				resp := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+				resp.AppendChild(packet.Children[0])
+				op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationBindResponse, nil, "")
+				op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(ldap.LDAPResultInvalidCredentials), ""))
+				op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+				op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString,
+					"80090308: LdapErr: DSID-0C09044E, comment: AcceptSecurityContext error, data 52e, v4563", ""))
+				resp.AppendChild(op)
+				conn.Write(resp.Bytes())
+				ber.ReadPacket(conn)
+			}()
+		}
+	}()
+
+	for _, detailed := range []bool{false, true} {
+		config := &Config{Server: l.Addr().String(), Security: SecurityNone, BaseDN: "DC=example,DC=com", DetailedErrors: detailed}
+		err := UpdatePassword(config, "jdoe", "invalid password", "Random654!")
+		if !errors.Is(err, ErrWrongPassword) {
+			t.Errorf("DetailedErrors %v: Expected ErrWrongPassword but got: %v", detailed, err)
+		}
+
+		var bindErr *BindError
+		if detailed && (!errors.As(err, &bindErr) || bindErr.Code != ADCodeInvalidCredentials || !errors.Is(err, ErrInvalidCredentials)) {
+			t.Errorf("DetailedErrors %v: Expected *BindError with ErrInvalidCredentials but got: %v", detailed, err)
+		}
+	}
+}
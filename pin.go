@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+//PeerCertificate is a certificate presented by a server during the TLS handshake.
+type PeerCertificate struct {
+	Certificate *x509.Certificate
+	//Pin is the certificate's pin in the format used by Config.Pins.
+	Pin string
+}
+
+//CertificatePin returns the pin of cert's public key in the format used by Config.Pins:
+//the base64 encoded SHA-256 hash of its SubjectPublicKeyInfo.
+func CertificatePin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+//InspectCertificates connects to a configured server like Connect, completes the TLS handshake without verifying the server's
+//certificate, and returns the chain the server presented, leaf first, or an error if one occurred.
+//It can be used to bootstrap Config.Pins. Security must be one of the TLS or StartTLS types; no bind is performed.
+//TLS sessions aren't resumed from TLSConfig.ClientSessionCache, so the chain is always the one presented now.
+func (c *Config) InspectCertificates() ([]PeerCertificate, error) {
+	return c.InspectCertificatesContext(context.Background())
+}
+
+//InspectCertificatesContext is like InspectCertificates but dialing and the TLS handshake are aborted if ctx is done.
+func (c *Config) InspectCertificatesContext(ctx context.Context) ([]PeerCertificate, error) {
+	inspect := *c
+	switch c.Security {
+	case SecurityTLS, SecurityInsecureTLS, SecurityPinnedTLS:
+		inspect.Security = SecurityInsecureTLS
+	case SecurityStartTLS, SecurityInsecureStartTLS, SecurityPinnedStartTLS:
+		inspect.Security = SecurityInsecureStartTLS
+	default:
+		return nil, errors.New("Configuration error: InspectCertificates requires a TLS or StartTLS SecurityType")
+	}
+	//a resumed session may not report the chain the server presents now
+	if c.TLSConfig != nil && c.TLSConfig.ClientSessionCache != nil {
+		inspect.TLSConfig = c.TLSConfig.Clone()
+		inspect.TLSConfig.ClientSessionCache = nil
+	}
+
+	conn, err := inspect.ConnectContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Conn.Close()
+
+	state, ok := conn.Conn.TLSConnectionState()
+	if !ok {
+		return nil, errors.New("Connection error: connection doesn't use TLS")
+	}
+
+	chain := make([]PeerCertificate, 0, len(state.PeerCertificates))
+	for _, cert := range state.PeerCertificates {
+		chain = append(chain, PeerCertificate{Certificate: cert, Pin: CertificatePin(cert)})
+	}
+
+	return chain, nil
+}
+
+//checkPins returns an error if Pins is empty or holds an invalid pin.
+func (c *Config) checkPins() error {
+	if len(c.Pins) == 0 {
+		return errors.New("Configuration error: no certificate Pins given")
+	}
+
+	for _, pin := range c.Pins {
+		if b, err := base64.StdEncoding.DecodeString(pin); err != nil || len(b) != sha256.Size {
+			return fmt.Errorf(`Configuration error: invalid certificate pin "%s"`, pin)
+		}
+	}
+
+	return nil
+}
+
+//pinned returns true if pin is one of Pins.
+func (c *Config) pinned(pin string) bool {
+	for _, p := range c.Pins {
+		if p == pin {
+			return true
+		}
+	}
+	return false
+}
+
+//verifyPins returns a tls.Config.VerifyPeerCertificate function that accepts a chain if its leaf certificate is pinned,
+//or if it is valid for serverName up to a pinned certificate. The pinned certificate may be presented by the server,
+//or be part of a chain verified with roots, e.g. a root CA the server doesn't send; if roots is nil, the system roots are used.
+//next, if not nil, is called after the chain is accepted.
+func (c *Config) verifyPins(serverName string, roots *x509.CertPool, next func([][]byte, [][]*x509.Certificate) error) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("server presented no certificates")
+		}
+
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[i] = cert
+		}
+
+		if !c.pinned(CertificatePin(certs[0])) {
+			if err := c.verifyPinnedChain(serverName, roots, certs); err != nil {
+				return err
+			}
+		}
+
+		if next != nil {
+			return next(rawCerts, nil)
+		}
+		return nil
+	}
+}
+
+//verifyPinnedChain returns an error unless certs, leaf first, is valid for serverName up to a pinned certificate,
+//either one presented in certs or one in a chain verified with roots.
+func (c *Config) verifyPinnedChain(serverName string, roots *x509.CertPool, certs []*x509.Certificate) error {
+	pinnedRoots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	found := false
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+		if c.pinned(CertificatePin(cert)) {
+			pinnedRoots.AddCert(cert)
+			found = true
+		}
+	}
+
+	var err error
+	if found {
+		if _, err = certs[0].Verify(x509.VerifyOptions{DNSName: serverName, Roots: pinnedRoots, Intermediates: intermediates}); err == nil {
+			return nil
+		}
+	}
+
+	//the pinned certificate may not be presented, e.g. a root CA
+	chains, verr := certs[0].Verify(x509.VerifyOptions{DNSName: serverName, Roots: roots, Intermediates: intermediates})
+	if verr == nil {
+		for _, chain := range chains {
+			for _, cert := range chain[1:] {
+				if c.pinned(CertificatePin(cert)) {
+					return nil
+				}
+			}
+		}
+		if err == nil {
+			return fmt.Errorf("no certificate presented by %s or in its verified chains matches a pin", serverName)
+		}
+	} else if err == nil {
+		err = verr
+	}
+
+	return fmt.Errorf("certificate presented by %s doesn't chain to a pinned certificate: %w", serverName, err)
+}
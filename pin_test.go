@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"strings"
+	"testing"
+)
+
+func TestConfigPinnedTLS(t *testing.T) {
+	ca := testCertificate(t, "Example CA")
+	issued := testIssuedCertificate(t, "dc1.example.com", &ca)
+	selfSigned := testCertificate(t, "dc1.example.com")
+	//a certificate not issued by ca, presented with ca to look like it was
+	forged := testCertificate(t, "dc1.example.com")
+	forged.Certificate = append(forged.Certificate, ca.Certificate...)
+
+	issuedTLS := listenLDAP(t, &tls.Config{Certificates: []tls.Certificate{issued}}, false)
+	defer issuedTLS.Close()
+	issuedStartTLS := listenLDAP(t, &tls.Config{Certificates: []tls.Certificate{issued}}, true)
+	defer issuedStartTLS.Close()
+	selfSignedTLS := listenLDAP(t, &tls.Config{Certificates: []tls.Certificate{selfSigned}}, false)
+	defer selfSignedTLS.Close()
+	forgedTLS := listenLDAP(t, &tls.Config{Certificates: []tls.Certificate{forged}}, false)
+	defer forgedTLS.Close()
+
+	caPin, issuedPin, selfSignedPin := CertificatePin(ca.Leaf), CertificatePin(issued.Leaf), CertificatePin(selfSigned.Leaf)
+
+	type test struct {
+		name     string
+		server   string
+		security SecurityType
+		pins     []string
+		hostname string
+		success  bool
+	}
+
+	tests := []test{
+		{"Leaf pin", selfSignedTLS.Addr().String(), SecurityPinnedTLS, []string{selfSignedPin}, "", true},
+		{"Leaf pin with other pins", issuedTLS.Addr().String(), SecurityPinnedTLS, []string{selfSignedPin, issuedPin}, "", true},
+		{"Leaf pin StartTLS", issuedStartTLS.Addr().String(), SecurityPinnedStartTLS, []string{issuedPin}, "", true},
+		{"Unpinned", selfSignedTLS.Addr().String(), SecurityPinnedTLS, []string{issuedPin, caPin}, "dc1.example.com", false},
+		{"CA pin", issuedTLS.Addr().String(), SecurityPinnedTLS, []string{caPin}, "dc1.example.com", true},
+		{"CA pin StartTLS", issuedStartTLS.Addr().String(), SecurityPinnedStartTLS, []string{caPin}, "dc1.example.com", true},
+		{"CA pin wrong hostname", issuedTLS.Addr().String(), SecurityPinnedTLS, []string{caPin}, "dc2.example.com", false},
+		{"CA pin forged chain", forgedTLS.Addr().String(), SecurityPinnedTLS, []string{caPin}, "dc1.example.com", false},
+	}
+
+	for _, test := range tests {
+		config := &Config{Servers: []string{test.server}, Security: test.security, Pins: test.pins, ServerName: test.hostname}
+		conn, err := config.Connect()
+		if !test.success {
+			if err == nil {
+				conn.Conn.Close()
+				t.Errorf("%s: Expected connect error but got nil", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Expected connect error to be nil but got: %v", test.name, err)
+			continue
+		}
+		conn.Conn.Close()
+	}
+
+	//a pinned CA the server doesn't present is found in chains built with RootCAs
+	leafOnly := issued
+	leafOnly.Certificate = issued.Certificate[:1]
+	leafOnlyTLS := listenLDAP(t, &tls.Config{Certificates: []tls.Certificate{leafOnly}}, false)
+	defer leafOnlyTLS.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+	otherCA := testCertificate(t, "Other CA")
+	for _, test := range []struct {
+		name    string
+		roots   *x509.CertPool
+		pins    []string
+		success bool
+	}{
+		{"Unpresented CA pin", roots, []string{caPin}, true},
+		{"Unpresented CA pin without RootCAs", nil, []string{caPin}, false},
+		{"Unpresented CA unpinned", roots, []string{CertificatePin(otherCA.Leaf)}, false},
+	} {
+		config := &Config{Servers: []string{leafOnlyTLS.Addr().String()}, Security: SecurityPinnedTLS, Pins: test.pins,
+			ServerName: "dc1.example.com", RootCAs: test.roots}
+		conn, err := config.Connect()
+		if err == nil {
+			conn.Conn.Close()
+		}
+		if (err == nil) != test.success {
+			t.Errorf("%s: Expected success %v but got: %v", test.name, test.success, err)
+		}
+	}
+
+	//a session resumed from a shared cache must not skip the pin check
+	cache := tls.NewLRUClientSessionCache(1)
+	config := &Config{Servers: []string{selfSignedTLS.Addr().String()}, Security: SecurityInsecureTLS, TLSConfig: &tls.Config{ClientSessionCache: cache}}
+	conn, err := config.Connect()
+	if err != nil {
+		t.Fatal("Session cache: Expected connect error to be nil but got:", err)
+	}
+	//reading a response receives the session ticket
+	if _, err = conn.Conn.WhoAmI(nil); err != nil {
+		t.Fatal("Session cache: Expected WhoAmI error to be nil but got:", err)
+	}
+	conn.Conn.Close()
+
+	config.Security, config.Pins = SecurityPinnedTLS, []string{issuedPin}
+	if conn, err = config.Connect(); err == nil {
+		conn.Conn.Close()
+		t.Error("Resumed session: Expected connect error but got nil")
+	}
+
+	for _, pins := range [][]string{nil, {"not base64!"}, {"c2hvcnQ="}} {
+		config := &Config{Servers: []string{selfSignedTLS.Addr().String()}, Security: SecurityPinnedTLS, Pins: pins}
+		if _, err := config.Connect(); err == nil || !strings.Contains(err.Error(), "Configuration error") {
+			t.Errorf("Pins %q: Expected configuration error but got: %v", pins, err)
+		}
+	}
+}
+
+func TestConfigInspectCertificates(t *testing.T) {
+	ca := testCertificate(t, "Example CA")
+	issued := testIssuedCertificate(t, "dc1.example.com", &ca)
+
+	l := listenLDAP(t, &tls.Config{Certificates: []tls.Certificate{issued}}, true)
+	defer l.Close()
+
+	config := &Config{Servers: []string{l.Addr().String()}, Security: SecurityPinnedStartTLS, Pins: []string{"unknown"}}
+	chain, err := config.InspectCertificates()
+	if err != nil {
+		t.Fatal("Expected err to be nil but got:", err)
+	}
+
+	if len(chain) != 2 {
+		t.Fatalf("Expected chain of 2 certificates but got %d", len(chain))
+	}
+	if !chain[0].Certificate.Equal(issued.Leaf) || chain[0].Pin != CertificatePin(issued.Leaf) {
+		t.Errorf("Expected leaf certificate with pin %s but got: %s, %s", CertificatePin(issued.Leaf), chain[0].Certificate.Subject, chain[0].Pin)
+	}
+	if !chain[1].Certificate.Equal(ca.Leaf) || chain[1].Pin != CertificatePin(ca.Leaf) {
+		t.Errorf("Expected CA certificate with pin %s but got: %s, %s", CertificatePin(ca.Leaf), chain[1].Certificate.Subject, chain[1].Pin)
+	}
+
+	//the reported pins are accepted by Connect
+	config.Pins = []string{chain[0].Pin}
+	conn, err := config.Connect()
+	if err != nil {
+		t.Fatal("Pinned: Expected connect error to be nil but got:", err)
+	}
+	conn.Conn.Close()
+
+	config.Security = SecurityNone
+	if _, err = config.InspectCertificates(); err == nil {
+		t.Error("SecurityNone: Expected error but got nil")
+	}
+}
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+//pwdProperties flags, described at https://learn.microsoft.com/en-us/windows/win32/adschema/a-pwdproperties
+const (
+	pwdPropertiesComplex        = 0x1
+	pwdPropertiesStoreCleartext = 0x10
+)
+
+//PasswordPolicy is the password and lockout policy that applies to a user.
+type PasswordPolicy struct {
+	//DN is the DN of the domain or of the fine-grained password settings object (PSO) the policy was read from.
+	DN string
+	//FineGrained is true if the policy was read from a PSO (msDS-ResultantPSO) rather than the domain.
+	FineGrained bool
+	//Precedence is the PSO's msDS-PasswordSettingsPrecedence, or 0 for the domain policy.
+	Precedence int
+
+	MinPasswordLength     int
+	PasswordHistoryLength int
+	//ComplexityEnabled is true if passwords must meet Active Directory's complexity requirements (see Validate).
+	ComplexityEnabled           bool
+	ReversibleEncryptionEnabled bool
+	MinPasswordAge              time.Duration
+	//MaxPasswordAge is 0 if passwords never expire.
+	MaxPasswordAge time.Duration
+
+	//LockoutThreshold is the number of bad passwords before an account is locked, or 0 if accounts are never locked.
+	LockoutThreshold int
+	//LockoutDuration is 0 if locked accounts stay locked until unlocked by an administrator.
+	LockoutDuration          time.Duration
+	LockoutObservationWindow time.Duration
+}
+
+var domainPolicyAttrs = []string{
+	"minPwdLength", "pwdHistoryLength", "pwdProperties", "minPwdAge", "maxPwdAge",
+	"lockoutThreshold", "lockoutDuration", "lockOutObservationWindow",
+}
+
+var psoAttrs = []string{
+	"msDS-PasswordSettingsPrecedence", "msDS-MinimumPasswordLength", "msDS-PasswordHistoryLength",
+	"msDS-PasswordComplexityEnabled", "msDS-PasswordReversibleEncryptionEnabled", "msDS-MinimumPasswordAge", "msDS-MaximumPasswordAge",
+	"msDS-LockoutThreshold", "msDS-LockoutDuration", "msDS-LockoutObservationWindow",
+}
+
+//DomainPasswordPolicy returns the default password policy of the domain or an error if one occurred.
+func (c *Conn) DomainPasswordPolicy() (*PasswordPolicy, error) {
+	domainDN, err := c.domainDN()
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := c.getEntry(domainDN, domainPolicyAttrs)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseDomainPolicy(entry)
+}
+
+//parseDomainPolicy returns the password policy read from the domain entry.
+func parseDomainPolicy(entry *ldap.Entry) (*PasswordPolicy, error) {
+	p := &PasswordPolicy{DN: entry.DN}
+	var properties int
+	parse := policyParser{entry: entry}
+	parse.int("minPwdLength", &p.MinPasswordLength)
+	parse.int("pwdHistoryLength", &p.PasswordHistoryLength)
+	parse.int("pwdProperties", &properties)
+	parse.interval("minPwdAge", &p.MinPasswordAge)
+	parse.interval("maxPwdAge", &p.MaxPasswordAge)
+	parse.int("lockoutThreshold", &p.LockoutThreshold)
+	parse.interval("lockoutDuration", &p.LockoutDuration)
+	parse.interval("lockOutObservationWindow", &p.LockoutObservationWindow)
+	if parse.err != nil {
+		return nil, parse.err
+	}
+
+	p.ComplexityEnabled = properties&pwdPropertiesComplex != 0
+	p.ReversibleEncryptionEnabled = properties&pwdPropertiesStoreCleartext != 0
+
+	return p, nil
+}
+
+//PasswordPolicy returns the effective password policy for the user with the given DN or an error if one occurred.
+//If a fine-grained password policy applies to the user (msDS-ResultantPSO), it is returned, otherwise the domain policy is returned.
+//By default, only administrators can read PSOs, so the connection must be bound as a user with read access to the Password Settings Container.
+func (c *Conn) PasswordPolicy(dn string) (*PasswordPolicy, error) {
+	entry, err := c.getEntry(dn, []string{"msDS-ResultantPSO"})
+	if err != nil {
+		return nil, err
+	}
+
+	psoDN := entry.GetAttributeValue("msDS-ResultantPSO")
+	if psoDN == "" {
+		return c.DomainPasswordPolicy()
+	}
+
+	return c.psoPolicy(psoDN)
+}
+
+func (c *Conn) psoPolicy(dn string) (*PasswordPolicy, error) {
+	entry, err := c.getEntry(dn, psoAttrs)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePSOPolicy(entry)
+}
+
+//parsePSOPolicy returns the password policy read from the PSO entry.
+func parsePSOPolicy(entry *ldap.Entry) (*PasswordPolicy, error) {
+	p := &PasswordPolicy{DN: entry.DN, FineGrained: true}
+	parse := policyParser{entry: entry}
+	parse.int("msDS-PasswordSettingsPrecedence", &p.Precedence)
+	parse.int("msDS-MinimumPasswordLength", &p.MinPasswordLength)
+	parse.int("msDS-PasswordHistoryLength", &p.PasswordHistoryLength)
+	parse.bool("msDS-PasswordComplexityEnabled", &p.ComplexityEnabled)
+	parse.bool("msDS-PasswordReversibleEncryptionEnabled", &p.ReversibleEncryptionEnabled)
+	parse.interval("msDS-MinimumPasswordAge", &p.MinPasswordAge)
+	parse.interval("msDS-MaximumPasswordAge", &p.MaxPasswordAge)
+	parse.int("msDS-LockoutThreshold", &p.LockoutThreshold)
+	parse.interval("msDS-LockoutDuration", &p.LockoutDuration)
+	parse.interval("msDS-LockoutObservationWindow", &p.LockoutObservationWindow)
+	if parse.err != nil {
+		return nil, parse.err
+	}
+
+	return p, nil
+}
+
+//policyParser parses policy attributes from entry, keeping the first error. Missing attributes are left unchanged.
+type policyParser struct {
+	entry *ldap.Entry
+	err   error
+}
+
+func (p *policyParser) value(attr string) string {
+	if p.err != nil {
+		return ""
+	}
+	return p.entry.GetAttributeValue(attr)
+}
+
+func (p *policyParser) int(attr string, v *int) {
+	if value := p.value(attr); value != "" {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			p.err = fmt.Errorf(`Parse error: invalid %s ("%s"): %w`, attr, value, err)
+			return
+		}
+		*v = i
+	}
+}
+
+func (p *policyParser) bool(attr string, v *bool) {
+	if value := p.value(attr); value != "" {
+		*v = strings.EqualFold(value, "TRUE")
+	}
+}
+
+func (p *policyParser) interval(attr string, v *time.Duration) {
+	if value := p.value(attr); value != "" {
+		d, err := parseInterval(value)
+		if err != nil {
+			p.err = fmt.Errorf(`Parse error: invalid %s ("%s"): %w`, attr, value, err)
+			return
+		}
+		*v = d
+	}
+}
+
+//parseInterval parses an Active Directory interval, a negative number of 100-nanosecond intervals, e.g. the value of maxPwdAge.
+//The "never" values 0 and math.MinInt64, and intervals too long for a time.Duration, return 0.
+func parseInterval(s string) (time.Duration, error) {
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	if i == math.MinInt64 {
+		return 0, nil
+	}
+	if i < 0 {
+		i = -i
+	}
+	if i > math.MaxInt64/100 {
+		return 0, nil
+	}
+
+	return time.Duration(i) * 100, nil
+}
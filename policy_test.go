@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+func TestParseInterval(t *testing.T) {
+	tests := map[string]time.Duration{
+		"-36288000000000":      42 * 24 * time.Hour,
+		"-864000000000":        24 * time.Hour,
+		"-18000000000":         30 * time.Minute,
+		"18000000000":          30 * time.Minute,
+		"0":                    0,
+		"-9223372036854775808": 0,
+	}
+
+	for value, want := range tests {
+		have, err := parseInterval(value)
+		if err != nil {
+			t.Errorf("could not parse %s: %v", value, err)
+			continue
+		}
+		if have != want {
+			t.Errorf("expected interval %s to be equal: want: %v, have: %v", value, want, have)
+		}
+	}
+
+	if _, err := parseInterval("never"); err == nil {
+		t.Error("expected invalid interval to fail")
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	domain := ldap.NewEntry("DC=example,DC=com", map[string][]string{
+		"minPwdLength":             {"7"},
+		"pwdHistoryLength":         {"24"},
+		"pwdProperties":            {"17"},
+		"minPwdAge":                {"-864000000000"},
+		"maxPwdAge":                {"-36288000000000"},
+		"lockoutThreshold":         {"5"},
+		"lockoutDuration":          {"-9223372036854775808"},
+		"lockOutObservationWindow": {"-18000000000"},
+	})
+
+	p, err := parseDomainPolicy(domain)
+	if err != nil {
+		t.Fatal("Expected err to be nil but got:", err)
+	}
+
+	want := PasswordPolicy{
+		DN:                          "DC=example,DC=com",
+		MinPasswordLength:           7,
+		PasswordHistoryLength:       24,
+		ComplexityEnabled:           true,
+		ReversibleEncryptionEnabled: true,
+		MinPasswordAge:              24 * time.Hour,
+		MaxPasswordAge:              42 * 24 * time.Hour,
+		LockoutThreshold:            5,
+		LockoutObservationWindow:    30 * time.Minute,
+	}
+	if *p != want {
+		t.Errorf("Expected domain policy to be %+v but got %+v", want, *p)
+	}
+
+	pso := ldap.NewEntry("CN=Admins,CN=Password Settings Container,CN=System,DC=example,DC=com", map[string][]string{
+		"msDS-PasswordSettingsPrecedence":          {"10"},
+		"msDS-MinimumPasswordLength":               {"15"},
+		"msDS-PasswordHistoryLength":               {"12"},
+		"msDS-PasswordComplexityEnabled":           {"TRUE"},
+		"msDS-PasswordReversibleEncryptionEnabled": {"FALSE"},
+		"msDS-MinimumPasswordAge":                  {"0"},
+		"msDS-MaximumPasswordAge":                  {"-9223372036854775808"},
+		"msDS-LockoutThreshold":                    {"3"},
+		"msDS-LockoutDuration":                     {"-18000000000"},
+		"msDS-LockoutObservationWindow":            {"-18000000000"},
+	})
+
+	p, err = parsePSOPolicy(pso)
+	if err != nil {
+		t.Fatal("Expected err to be nil but got:", err)
+	}
+
+	want = PasswordPolicy{
+		DN:                       pso.DN,
+		FineGrained:              true,
+		Precedence:               10,
+		MinPasswordLength:        15,
+		PasswordHistoryLength:    12,
+		ComplexityEnabled:        true,
+		LockoutThreshold:         3,
+		LockoutDuration:          30 * time.Minute,
+		LockoutObservationWindow: 30 * time.Minute,
+	}
+	if *p != want {
+		t.Errorf("Expected PSO policy to be %+v but got %+v", want, *p)
+	}
+
+	if _, err = parseDomainPolicy(ldap.NewEntry("DC=example,DC=com", map[string][]string{"minPwdLength": {"seven"}})); err == nil {
+		t.Error("Expected invalid policy to fail")
+	}
+}
+
+func TestConnPasswordPolicy(t *testing.T) {
+	if testConfig.Server == "" {
+		t.Skip("ADTEST_SERVER not set")
+		return
+	}
+
+	if testConfig.BindUPN == "" || testConfig.BindPass == "" {
+		t.Skip("ADTEST_BIND_UPN or ADTEST_BIND_PASS not set")
+		return
+	}
+
+	if testConfig.BaseDN == "" {
+		t.Skip("ADTEST_BASEDN not set")
+		return
+	}
+
+	config := &Config{Server: testConfig.Server, Port: testConfig.Port, Security: testConfig.BindSecurity, BaseDN: testConfig.BaseDN}
+	conn, err := config.Connect()
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Conn.Close()
+
+	status, err := conn.Bind(testConfig.BindUPN, testConfig.BindPass)
+	if err != nil {
+		t.Fatal("Error binding to server:", err)
+	}
+
+	if !status {
+		t.Fatal("Error binding to server: invalid credentials")
+	}
+
+	domain, err := conn.DomainPasswordPolicy()
+	if err != nil {
+		t.Fatal("DomainPasswordPolicy: Expected err to be nil but got:", err)
+	}
+
+	if domain.DN == "" || domain.FineGrained {
+		t.Error("DomainPasswordPolicy: Expected domain policy but got:", domain)
+	}
+
+	dn, err := conn.GetDN("userPrincipalName", testConfig.BindUPN)
+	if err != nil {
+		t.Fatal("Error getting user DN:", err)
+	}
+
+	if _, err = conn.PasswordPolicy(dn); err != nil {
+		t.Error("PasswordPolicy: Expected err to be nil but got:", err)
+	}
+}
@@ -0,0 +1,284 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+//poolBindTimeout is how long Put waits to rebind a connection as the service account before discarding it.
+const poolBindTimeout = 10 * time.Second
+
+//ErrPoolClosed is returned when getting a connection from a closed Pool.
+var ErrPoolClosed = errors.New("Pool error: pool closed")
+
+//Pool is a pool of connections bound as a service account. It is safe for concurrent use.
+//Connections are checked out with Get and must be returned with Put instead of being closed.
+type Pool struct {
+	config      *Config
+	upn         string
+	password    string
+	idleTimeout time.Duration
+	bindTimeout time.Duration
+
+	sem  chan struct{}
+	stop chan struct{}
+
+	mu   sync.Mutex
+	idle []idleConn
+	//out holds the connections checked out with Get, so they can only be returned once
+	out    map[*ldap.Conn]struct{}
+	closed bool
+}
+
+type idleConn struct {
+	conn  *Conn
+	since time.Time
+}
+
+//NewPool returns a Pool that connects with config and binds connections with the given userPrincipalName and password
+//using Config.BindMechanism. If Config.ServiceAccountNTHash is set, connections bind with NTLM using the hash instead of
+//password, and upn must be a sAMAccountName or down-level logon name (see Conn.NTLMBindHash).
+//At most maxSize connections are open at once; if maxSize <= 0 the number of connections is not limited.
+//Connections that have been idle longer than idleTimeout are closed; if idleTimeout <= 0 idle connections are kept open.
+//Close should be called when the Pool is no longer needed.
+func NewPool(config *Config, upn, password string, maxSize int, idleTimeout time.Duration) *Pool {
+	p := &Pool{
+		config:      config,
+		upn:         upn,
+		password:    password,
+		idleTimeout: idleTimeout,
+		bindTimeout: poolBindTimeout,
+		stop:        make(chan struct{}),
+		out:         make(map[*ldap.Conn]struct{}),
+	}
+
+	if maxSize > 0 {
+		p.sem = make(chan struct{}, maxSize)
+	}
+
+	if idleTimeout > 0 {
+		go p.evictLoop()
+	}
+
+	return p
+}
+
+//Get returns a connection bound as the pool's service account or an error if one occurred.
+//If the pool is at its maximum size, Get blocks until a connection is returned with Put.
+func (p *Pool) Get() (*Conn, error) {
+	return p.GetContext(context.Background())
+}
+
+//GetContext is like Get but waiting, connecting and binding are aborted if ctx is done.
+//The returned connection's operations are bound to ctx.
+func (p *Pool) GetContext(ctx context.Context) (*Conn, error) {
+	if p.sem != nil {
+		select {
+		case p.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("Pool error: %w", ctx.Err())
+		}
+	}
+
+	for {
+		conn, err := p.pop()
+		if err != nil {
+			p.release()
+			return nil, err
+		}
+		if conn == nil {
+			break
+		}
+
+		conn = conn.WithContext(ctx)
+		if err = conn.ping(); err == nil {
+			return p.checkOut(conn), nil
+		}
+		conn.Conn.Close()
+
+		if ctx.Err() != nil {
+			p.release()
+			return nil, fmt.Errorf("Pool error: %w", ctx.Err())
+		}
+	}
+
+	conn, err := p.config.ConnectContext(ctx)
+	if err != nil {
+		p.release()
+		return nil, err
+	}
+	conn = conn.WithContext(ctx)
+
+	if err = p.bind(conn); err != nil {
+		conn.Conn.Close()
+		p.release()
+		return nil, err
+	}
+
+	return p.checkOut(conn), nil
+}
+
+//checkOut records that conn was returned by GetContext.
+func (p *Pool) checkOut(conn *Conn) *Conn {
+	p.mu.Lock()
+	p.out[conn.Conn] = struct{}{}
+	p.mu.Unlock()
+	return conn
+}
+
+//Put returns conn to the pool. If conn was bound as another user (e.g. to check a user's credentials),
+//it is rebound as the pool's service account first. Connections that are closed or fail to rebind within 10 seconds are discarded.
+//conn must have been returned by Get or GetContext on the same Pool. Returning a connection that isn't checked out,
+//e.g. one that was already returned, does nothing.
+func (p *Pool) Put(conn *Conn) {
+	p.mu.Lock()
+	if _, ok := p.out[conn.Conn]; !ok {
+		p.mu.Unlock()
+		return
+	}
+	delete(p.out, conn.Conn)
+	closed := p.closed
+	p.mu.Unlock()
+
+	defer p.release()
+
+	//drop any context the connection was checked out with, but don't let a hung server block the caller
+	ctx, cancel := context.WithTimeout(context.Background(), p.bindTimeout)
+	defer cancel()
+	conn = conn.WithContext(ctx)
+
+	if closed || conn.Conn.IsClosing() {
+		conn.Conn.Close()
+		return
+	}
+
+	if conn.boundAs() != p.upn {
+		if err := p.bind(conn); err != nil {
+			conn.Conn.Close()
+			return
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		conn.Conn.Close()
+		return
+	}
+
+	p.idle = append(p.idle, idleConn{conn: conn.WithContext(context.Background()), since: time.Now()})
+}
+
+//Close closes all idle connections. Connections that are checked out are closed when they are returned with Put.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.stop)
+
+	for _, ic := range p.idle {
+		ic.conn.Conn.Close()
+	}
+	p.idle = nil
+}
+
+//pop returns the most recently used idle connection, or nil if there aren't any. Expired connections are closed.
+func (p *Pool) pop() (*Conn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, ErrPoolClosed
+	}
+
+	for len(p.idle) > 0 {
+		ic := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+
+		if p.idleTimeout > 0 && time.Since(ic.since) > p.idleTimeout {
+			ic.conn.Conn.Close()
+			continue
+		}
+
+		return ic.conn, nil
+	}
+
+	return nil, nil
+}
+
+//bind binds conn as the pool's service account, using NTLM if Config.ServiceAccountNTHash is set
+//or Config.BindMechanism otherwise.
+func (p *Pool) bind(conn *Conn) error {
+	var (
+		status bool
+		err    error
+	)
+	if p.config.ServiceAccountNTHash != "" {
+		status, err = conn.NTLMBindHash(p.upn, p.config.ServiceAccountNTHash)
+	} else {
+		status, err = conn.bindWith(p.config.BindMechanism, p.upn, p.password)
+	}
+	if err != nil {
+		return err
+	}
+	if !status {
+		return fmt.Errorf("Pool error: invalid credentials for %s", p.upn)
+	}
+	return nil
+}
+
+//release frees a slot taken by GetContext.
+func (p *Pool) release() {
+	if p.sem != nil {
+		<-p.sem
+	}
+}
+
+//evictLoop closes idle connections that have expired until the pool is closed.
+func (p *Pool) evictLoop() {
+	t := time.NewTicker(p.idleTimeout / 2)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			p.evict()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+//evict closes idle connections that have been idle longer than the pool's idle timeout.
+func (p *Pool) evict() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	//idle is ordered from least to most recently used
+	n := 0
+	for n < len(p.idle) && time.Since(p.idle[n].since) > p.idleTimeout {
+		p.idle[n].conn.Conn.Close()
+		n++
+	}
+	p.idle = append(p.idle[:0], p.idle[n:]...)
+}
+
+//ping checks that the connection is still usable by reading the rootDSE.
+func (c *Conn) ping() error {
+	if c.Conn.IsClosing() {
+		return errors.New("Connection error: connection closed")
+	}
+
+	_, err := c.RootDSE([]string{"1.1"})
+	return err
+}
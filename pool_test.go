@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+func TestPool(t *testing.T) {
+	//listener accepts connections but never responds
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error starting listener:", err)
+	}
+	defer l.Close()
+
+	pool := NewPool(&Config{Server: l.Addr().String(), Security: SecurityNone}, "test@example.com", "password", 1, time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = pool.GetContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Unresponsive server: Expected deadline exceeded error but got:", err)
+	}
+
+	pool.Close()
+	if _, err = pool.Get(); !errors.Is(err, ErrPoolClosed) {
+		t.Error("Closed pool: Expected pool closed error but got:", err)
+	}
+
+	if testConfig.Server == "" {
+		t.Skip("ADTEST_SERVER not set")
+		return
+	}
+
+	if testConfig.BindUPN == "" || testConfig.BindPass == "" {
+		t.Skip("ADTEST_BIND_UPN or ADTEST_BIND_PASS not set")
+		return
+	}
+
+	if testConfig.BaseDN == "" {
+		t.Skip("ADTEST_BASEDN not set")
+		return
+	}
+
+	config := &Config{Server: testConfig.Server, Port: testConfig.Port, Security: testConfig.BindSecurity, BaseDN: testConfig.BaseDN}
+	pool = NewPool(config, testConfig.BindUPN, testConfig.BindPass, 1, time.Minute)
+	defer pool.Close()
+
+	conn, err := pool.Get()
+	if err != nil {
+		t.Fatal("Expected err to be nil but got:", err)
+	}
+
+	if _, err = conn.GetDN("userPrincipalName", testConfig.BindUPN); err != nil {
+		t.Error("Search: Expected err to be nil but got:", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = pool.GetContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Max size: Expected deadline exceeded error but got:", err)
+	}
+
+	//change the connection's identity
+	if status, _ := conn.Bind("go-ad-auth", "invalid_password"); status {
+		t.Error("Invalid credentials: Expected authentication status to be false")
+	}
+
+	pool.Put(conn)
+
+	conn2, err := pool.Get()
+	if err != nil {
+		t.Fatal("Reuse: Expected err to be nil but got:", err)
+	}
+	if conn2.Conn != conn.Conn {
+		t.Error("Reuse: Expected idle connection to be reused")
+	}
+	if conn2.boundAs() != testConfig.BindUPN {
+		t.Error("Reuse: Expected connection to be rebound as service account")
+	}
+
+	pool.Put(conn2)
+}
+
+//servePool answers binds and searches on conn until it's closed. Binds are left unanswered while hang is set.
+func servePool(conn net.Conn, hang *int32) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+
+		var out []byte
+		switch packet.Children[1].Tag {
+		case ldap.ApplicationBindRequest:
+			if atomic.LoadInt32(hang) != 0 {
+				continue
+			}
+			out = ldapResponse(id, ldap.ApplicationBindResponse, ldap.LDAPResultSuccess).Bytes()
+		case ldap.ApplicationSearchRequest:
+			entry := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+			entry.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+			op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+			op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+			op.AppendChild(ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, ""))
+			entry.AppendChild(op)
+			out = append(entry.Bytes(), ldapResponse(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes()...)
+		default:
+			return
+		}
+
+		if _, err = conn.Write(out); err != nil {
+			return
+		}
+	}
+}
+
+func TestPoolPut(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error starting listener:", err)
+	}
+	defer l.Close()
+
+	var hang int32
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go servePool(conn, &hang)
+		}
+	}()
+
+	pool := NewPool(&Config{Server: l.Addr().String(), Security: SecurityNone}, "svc@example.com", "password", 1, time.Minute)
+	pool.bindTimeout = 50 * time.Millisecond
+	defer pool.Close()
+
+	conn, err := pool.Get()
+	if err != nil {
+		t.Fatal("Expected err to be nil but got:", err)
+	}
+
+	pool.Put(conn)
+	//a second Put must not add the connection again or free another slot
+	pool.Put(conn)
+
+	conn2, err := pool.Get()
+	if err != nil {
+		t.Fatal("Reuse: Expected err to be nil but got:", err)
+	}
+	if conn2.Conn != conn.Conn {
+		t.Error("Reuse: Expected idle connection to be reused")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = pool.GetContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Double Put: Expected deadline exceeded error but got:", err)
+	}
+
+	//a hung rebind discards the connection instead of blocking Put
+	conn2.setBound("user@example.com")
+	atomic.StoreInt32(&hang, 1)
+	done := make(chan struct{})
+	go func() {
+		pool.Put(conn2)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Hung rebind: Expected Put to return")
+	}
+	if !conn2.Conn.IsClosing() {
+		t.Error("Hung rebind: Expected connection to be discarded")
+	}
+
+	atomic.StoreInt32(&hang, 0)
+	conn3, err := pool.Get()
+	if err != nil {
+		t.Fatal("After discard: Expected err to be nil but got:", err)
+	}
+	if conn3.Conn == conn2.Conn {
+		t.Error("After discard: Expected a new connection")
+	}
+	pool.Put(conn3)
+}
+
+//serveNTLM answers NTLM binds on conn with a challenge and then success, and sends the authentication choice
+//of each bind request, e.g. 0 for a simple bind, on binds, until it's closed.
+func serveNTLM(conn net.Conn, binds chan<- ber.Tag) {
+	defer conn.Close()
+
+	//a challenge message without target name or info (MS-NLMP section 2.2.1.2)
+	challenge := make([]byte, 48)
+	copy(challenge, "NTLMSSP\x00")
+	binary.LittleEndian.PutUint32(challenge[8:], 2)
+	binary.LittleEndian.PutUint32(challenge[20:], 1)
+	copy(challenge[24:], "01234567")
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 || packet.Children[1].Tag != ldap.ApplicationBindRequest {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		auth := packet.Children[1].Children[2].Tag
+		binds <- auth
+
+		var resp *ber.Packet
+		if auth == 10 {
+			resp = ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+			resp.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+			op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationBindResponse, nil, "")
+			op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(ldap.LDAPResultSuccess), ""))
+			op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(challenge), ""))
+			op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+			resp.AppendChild(op)
+		} else {
+			resp = ldapResponse(id, ldap.ApplicationBindResponse, ldap.LDAPResultSuccess)
+		}
+
+		if _, err = conn.Write(resp.Bytes()); err != nil {
+			return
+		}
+	}
+}
+
+func TestPoolNTHash(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error starting listener:", err)
+	}
+	defer l.Close()
+
+	binds := make(chan ber.Tag, 4)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveNTLM(conn, binds)
+		}
+	}()
+
+	config := &Config{Server: l.Addr().String(), Security: SecurityNone, ServiceAccountNTHash: "8846f7eaee8fb117ad06bdd830b7586c"}
+	pool := NewPool(config, `CORP\svc-ldap`, "", 1, time.Minute)
+	defer pool.Close()
+
+	conn, err := pool.Get()
+	if err != nil {
+		t.Fatal("Expected err to be nil but got:", err)
+	}
+	defer pool.Put(conn)
+
+	//NTLM negotiate (10) and then the authenticate message (11), instead of a simple bind (0)
+	for _, expected := range []ber.Tag{10, 11} {
+		if auth := <-binds; auth != expected {
+			t.Errorf("Expected bind with authentication choice %d but got: %d", expected, auth)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package auth
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+//SASL security layers, as offered and selected in the last step of a SASL bind (RFC 4752 section 3.3)
+const (
+	saslLayerNone            byte = 1
+	saslLayerIntegrity       byte = 2
+	saslLayerConfidentiality byte = 4
+)
+
+//saslMaxBuffer is the largest wrapped buffer accepted from the server. It is also the largest size a 3 byte SASL length can advertise.
+const saslMaxBuffer = 0xFFFFFF
+
+//saslWrapOverhead is the room left in each wrapped buffer for a security layer's header, checksum and padding.
+const saslWrapOverhead = 64
+
+//errLayerUnavailable is returned when a bind needs a security layer on a connection that can't install one.
+var errLayerUnavailable = errors.New("SASL signing and sealing require a connection made with SecurityNone")
+
+//securityLayer protects the traffic of a connection after a SASL bind that negotiated integrity or confidentiality.
+type securityLayer interface {
+	Wrap(p []byte) ([]byte, error)
+	Unwrap(token []byte) ([]byte, error)
+}
+
+//chooseLayer returns the SASL security layer to select from the layers offered by the server, or an error if protection can't be met.
+//available is false if the connection can't install a security layer, e.g. because it uses TLS.
+func chooseLayer(protection SASLProtection, offered byte, available bool) (byte, error) {
+	want := []byte{saslLayerNone}
+	switch protection {
+	case ProtectionAuto:
+		if available {
+			want = []byte{saslLayerConfidentiality, saslLayerIntegrity, saslLayerNone}
+		}
+	case ProtectionSign, ProtectionSeal:
+		if !available {
+			return 0, errLayerUnavailable
+		}
+		want = []byte{saslLayerIntegrity}
+		if protection == ProtectionSeal {
+			want = []byte{saslLayerConfidentiality}
+		}
+	case ProtectionNone:
+	default:
+		return 0, errors.New("invalid SASLProtection")
+	}
+
+	for _, layer := range want {
+		if offered&layer != 0 {
+			return layer, nil
+		}
+	}
+
+	return 0, fmt.Errorf("server doesn't offer the requested SASL protection (offered: %#x)", offered)
+}
+
+//saslConn frames the traffic of a net.Conn with a SASL security layer once one is installed (RFC 4422 section 3.7).
+//Until then traffic passes through unchanged. Only while a saslBind is in flight are messages parsed, so its response
+//is routed back to it.
+type saslConn struct {
+	net.Conn
+	r *bufio.Reader
+
+	mu      sync.Mutex
+	layer   securityLayer
+	maxSend int
+	//pending maps the message IDs of requests sent with saslBind to the channels their responses are delivered to
+	pending map[int64]chan []byte
+	nextID  int64
+
+	//done is closed when reading fails, e.g. because the connection was closed
+	done     chan struct{}
+	doneOnce sync.Once
+
+	//buf holds bytes not yet returned by Read
+	buf []byte
+}
+
+func newSASLConn(conn net.Conn) *saslConn {
+	return &saslConn{
+		Conn:    conn,
+		r:       bufio.NewReader(conn),
+		pending: make(map[int64]chan []byte),
+		//count down from the largest message ID so IDs never collide with go-ldap's
+		nextID: math.MaxInt32,
+		done:   make(chan struct{}),
+	}
+}
+
+//install starts protecting traffic with layer. maxBuffer is the largest wrapped buffer the server accepts.
+//install must be called after the bind response was read and before any other request is sent.
+func (c *saslConn) install(layer securityLayer, maxBuffer int) {
+	//leave room for the layer's header, checksum and padding
+	if maxBuffer > saslWrapOverhead {
+		maxBuffer -= saslWrapOverhead
+	}
+
+	c.mu.Lock()
+	c.layer = layer
+	c.maxSend = maxBuffer
+	c.mu.Unlock()
+}
+
+//current returns the installed security layer, or nil if there isn't one, and the largest plaintext to wrap at once.
+func (c *saslConn) current() (securityLayer, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.layer, c.maxSend
+}
+
+//binding returns true if a request sent with saslBind is waiting for its response.
+func (c *saslConn) binding() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending) != 0
+}
+
+//hasSecurityLayer returns true if a SASL bind installed a security layer on the connection.
+func (c *Conn) hasSecurityLayer() bool {
+	if c.sasl == nil {
+		return false
+	}
+	layer, _ := c.sasl.current()
+	return layer != nil
+}
+
+func (c *saslConn) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		//wait for data before deciding how to read it, since a layer may be installed or a bind sent while waiting
+		_, err := c.r.Peek(1)
+		if err == nil {
+			layer, _ := c.current()
+			switch {
+			case layer != nil:
+				c.buf, err = c.readBuffer(layer)
+			case c.binding():
+				c.buf, err = c.readMessage()
+			default:
+				var n int
+				if n, err = c.r.Read(p); err == nil {
+					return n, nil
+				}
+			}
+		}
+		if err != nil {
+			c.doneOnce.Do(func() { close(c.done) })
+			return 0, err
+		}
+	}
+
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+//readBuffer reads and unwraps a length-prefixed buffer.
+func (c *saslConn) readBuffer(layer securityLayer) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(c.r, size[:]); err != nil {
+		return nil, err
+	}
+
+	n := binary.BigEndian.Uint32(size[:])
+	if n > saslMaxBuffer {
+		return nil, fmt.Errorf("SASL error: buffer size %d exceeds maximum %d", n, saslMaxBuffer)
+	}
+
+	token := make([]byte, n)
+	if _, err := io.ReadFull(c.r, token); err != nil {
+		return nil, err
+	}
+
+	buf, err := layer.Unwrap(token)
+	if err != nil {
+		return nil, fmt.Errorf("SASL error: %w", err)
+	}
+
+	return buf, nil
+}
+
+//readMessage reads an unprotected LDAP message. Responses to requests sent with saslBind are delivered to it instead,
+//and nil is returned.
+func (c *saslConn) readMessage() ([]byte, error) {
+	header := make([]byte, 2, 6)
+	if _, err := io.ReadFull(c.r, header); err != nil {
+		return nil, err
+	}
+
+	length := int(header[1])
+	if header[1]&0x80 != 0 {
+		n := int(header[1] & 0x7F)
+		if n == 0 || n > 4 {
+			return nil, fmt.Errorf("SASL error: unsupported BER length encoding %#x", header[1])
+		}
+		header = header[:2+n]
+		if _, err := io.ReadFull(c.r, header[2:]); err != nil {
+			return nil, err
+		}
+		length = 0
+		for _, b := range header[2:] {
+			length = length<<8 | int(b)
+		}
+	}
+
+	msg := make([]byte, len(header)+length)
+	copy(msg, header)
+	if _, err := io.ReadFull(c.r, msg[len(header):]); err != nil {
+		return nil, err
+	}
+
+	//the message ID is the first element of the message
+	content := msg[len(header):]
+	if len(content) > 2 && ber.Tag(content[0]) == ber.TagInteger && content[1] > 0 && content[1] <= 4 && len(content) >= 2+int(content[1]) {
+		var id int64
+		for _, b := range content[2 : 2+content[1]] {
+			id = id<<8 | int64(b)
+		}
+
+		c.mu.Lock()
+		ch := c.pending[id]
+		delete(c.pending, id)
+		c.mu.Unlock()
+
+		if ch != nil {
+			ch <- msg
+			return nil, nil
+		}
+	}
+
+	return msg, nil
+}
+
+func (c *saslConn) Write(p []byte) (int, error) {
+	layer, maxSend := c.current()
+	if layer == nil {
+		return c.Conn.Write(p)
+	}
+
+	for written := 0; written < len(p); {
+		chunk := p[written:]
+		if maxSend > 0 && len(chunk) > maxSend {
+			chunk = chunk[:maxSend]
+		}
+
+		token, err := layer.Wrap(chunk)
+		if err != nil {
+			return written, fmt.Errorf("SASL error: %w", err)
+		}
+
+		buf := make([]byte, 4+len(token))
+		binary.BigEndian.PutUint32(buf, uint32(len(token)))
+		copy(buf[4:], token)
+		if _, err = c.Conn.Write(buf); err != nil {
+			return written, err
+		}
+
+		written += len(chunk)
+	}
+
+	return len(p), nil
+}
+
+//saslBind sends a SASL bind request for mech directly on the connection and returns the server's credentials and whether
+//the bind is still in progress. cred is left out of the request if nil. go-ldap's DIGEST-MD5 (MD5Bind) and GSSAPI binds
+//don't expose the keys they negotiate, so a security layer couldn't be installed after them; instead the request bypasses
+//go-ldap and the response is routed back here. No security layer may be installed, and no other request may be outstanding,
+//since unprotected traffic is only parsed into messages while the bind is in flight.
+func (c *saslConn) saslBind(mech string, cred []byte) (inProgress bool, serverCred []byte, err error) {
+	ch := make(chan []byte, 1)
+
+	c.mu.Lock()
+	if c.layer != nil {
+		c.mu.Unlock()
+		return false, nil, errors.New("connection already has a SASL security layer")
+	}
+	id := c.nextID
+	c.nextID--
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	request := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationBindRequest, nil, "Bind Request")
+	request.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 3, "Version"))
+	request.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "User Name"))
+	auth := ber.Encode(ber.ClassContext, ber.TypeConstructed, 3, "", "authentication")
+	auth.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, mech, "SASL Mech"))
+	if cred != nil {
+		auth.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(cred), "Credentials"))
+	}
+	request.AppendChild(auth)
+	envelope.AppendChild(request)
+
+	if _, err = c.Conn.Write(envelope.Bytes()); err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return false, nil, err
+	}
+
+	var msg []byte
+	select {
+	case msg = <-ch:
+	case <-c.done:
+		return false, nil, ldap.NewError(ldap.ErrorNetwork, errors.New("connection closed"))
+	}
+
+	packet, err := ber.DecodePacketErr(msg)
+	if err != nil {
+		return false, nil, err
+	}
+	if len(packet.Children) < 2 || packet.Children[1].Tag != ldap.ApplicationBindResponse || len(packet.Children[1].Children) < 3 {
+		return false, nil, ldap.NewError(ldap.ErrorUnexpectedResponse, errors.New("invalid bind response"))
+	}
+	resp := packet.Children[1]
+
+	for _, child := range resp.Children[3:] {
+		//serverSaslCreds [7]
+		if child.ClassType == ber.ClassContext && child.Tag == 7 {
+			serverCred = child.Data.Bytes()
+		}
+	}
+
+	code, _ := resp.Children[0].Value.(int64)
+	switch code {
+	case ldap.LDAPResultSuccess:
+		return false, serverCred, nil
+	case ldap.LDAPResultSaslBindInProgress:
+		return true, serverCred, nil
+	}
+
+	return false, nil, ldap.GetLDAPError(packet)
+}
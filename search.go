@@ -1,30 +1,34 @@
 package auth
 
 import (
+	"context"
 	"fmt"
 
 	ldap "github.com/go-ldap/ldap/v3"
 )
 
 //Search returns the entries for the given search criteria or an error if one occurred.
+//Results are retrieved in pages of Config.PageSize entries, so searches can return more entries than the server's MaxPageSize.
+//If sizeLimit is greater than 0 and more than sizeLimit entries match, the server returns a size limit exceeded error.
 func (c *Conn) Search(filter string, attrs []string, sizeLimit int) ([]*ldap.Entry, error) {
-	search := ldap.NewSearchRequest(
-		c.Config.BaseDN,
-		ldap.ScopeWholeSubtree,
-		ldap.DerefAlways,
-		sizeLimit,
-		0,
-		false,
-		filter,
-		attrs,
-		nil,
-	)
-	result, err := c.Conn.Search(search)
-	if err != nil {
-		return nil, fmt.Errorf(`Search error "%s": %w`, filter, err)
+	it := c.newSearchIterator(c.Config.BaseDN, filter, attrs, sizeLimit, c.Config.pageSize())
+	defer it.Close()
+
+	var entries []*ldap.Entry
+	for it.Next() {
+		entries = append(entries, it.Entries()...)
+	}
+
+	if err := it.Err(); err != nil {
+		return nil, err
 	}
 
-	return result.Entries, nil
+	return entries, nil
+}
+
+//SearchContext is like Search but the search is aborted if ctx is done.
+func (c *Conn) SearchContext(ctx context.Context, filter string, attrs []string, sizeLimit int) ([]*ldap.Entry, error) {
+	return c.WithContext(ctx).Search(filter, attrs, sizeLimit)
 }
 
 //SearchOne returns the single entry for the given search criteria or an error if one occurred.
@@ -42,7 +46,11 @@ func (c *Conn) SearchOne(filter string, attrs []string) (*ldap.Entry, error) {
 		nil,
 	)
 
-	result, err := c.Conn.Search(search)
+	var result *ldap.SearchResult
+	err := c.do(func() (err error) {
+		result, err = c.Conn.Search(search)
+		return err
+	})
 	if err != nil {
 		if e, ok := err.(*ldap.Error); ok {
 			if e.ResultCode == ldap.LDAPResultSizeLimitExceeded {
@@ -60,6 +68,11 @@ func (c *Conn) SearchOne(filter string, attrs []string) (*ldap.Entry, error) {
 	return result.Entries[0], nil
 }
 
+//SearchOneContext is like SearchOne but the search is aborted if ctx is done.
+func (c *Conn) SearchOneContext(ctx context.Context, filter string, attrs []string) (*ldap.Entry, error) {
+	return c.WithContext(ctx).SearchOne(filter, attrs)
+}
+
 //GetDN returns the DN for the object with the given attribute value or an error if one occurred.
 //attr and value are sanitized.
 func (c *Conn) GetDN(attr, value string) (string, error) {
@@ -77,6 +90,174 @@ func (c *Conn) GetAttributes(attr, value string, attrs []string) (*ldap.Entry, e
 	return c.SearchOne(fmt.Sprintf("(%s=%s)", ldap.EscapeFilter(attr), ldap.EscapeFilter(value)), attrs)
 }
 
+//GetDNByGUID returns the DN for the object with the given objectGUID or an error if one occurred.
+func (c *Conn) GetDNByGUID(guid GUID) (string, error) {
+	entry, err := c.GetAttributesByGUID(guid, []string{""})
+	if err != nil {
+		return "", err
+	}
+
+	return entry.DN, nil
+}
+
+//GetAttributesByGUID returns the *ldap.Entry with the given attributes for the object with the given objectGUID or an error if one occurred.
+func (c *Conn) GetAttributesByGUID(guid GUID, attrs []string) (*ldap.Entry, error) {
+	return c.SearchOne(fmt.Sprintf("(objectGUID=%s)", guid.FilterString()), attrs)
+}
+
+//GetDNBySID returns the DN for the object with the given objectSid or an error if one occurred.
+func (c *Conn) GetDNBySID(sid *SID) (string, error) {
+	entry, err := c.GetAttributesBySID(sid, []string{""})
+	if err != nil {
+		return "", err
+	}
+
+	return entry.DN, nil
+}
+
+//GetAttributesBySID returns the *ldap.Entry with the given attributes for the object with the given objectSid or an error if one occurred.
+func (c *Conn) GetAttributesBySID(sid *SID, attrs []string) (*ldap.Entry, error) {
+	return c.SearchOne(fmt.Sprintf("(objectSid=%s)", sid.FilterString()), attrs)
+}
+
 func (c *Conn) getGroups(dn string) ([]*ldap.Entry, error) {
-	return c.Search(fmt.Sprintf("(member:%s:=%s)", LDAPMatchingRuleInChain, ldap.EscapeFilter(dn)), []string{""}, 1000)
+	if c.Config.GroupStrategy == GroupsTokenGroups {
+		sids, err := c.TokenGroups(dn)
+		if err != nil {
+			return nil, err
+		}
+		return c.resolveSIDs(sids)
+	}
+
+	groups, err := c.chainGroups(dn)
+	if err != nil || !c.Config.IncludePrimaryGroup {
+		return groups, err
+	}
+
+	return c.withPrimaryGroup(dn, groups)
+}
+
+func (c *Conn) chainGroups(dn string) ([]*ldap.Entry, error) {
+	return c.Search(fmt.Sprintf("(member:%s:=%s)", LDAPMatchingRuleInChain, ldap.EscapeFilter(dn)), []string{""}, 0)
+}
+
+//SearchIterator iterates over the results of a search one page at a time, without holding all results in memory.
+//
+//	it := conn.SearchPages("OU=Users,DC=example,DC=com", "(objectClass=user)", []string{"cn"}, 500)
+//	defer it.Close()
+//	for it.Next() {
+//		for _, entry := range it.Entries() {
+//			//use entry
+//		}
+//	}
+//	if err := it.Err(); err != nil {
+//		//handle err
+//	}
+type SearchIterator struct {
+	conn    *Conn
+	request *ldap.SearchRequest
+	paging  *ldap.ControlPaging
+	entries []*ldap.Entry
+	err     error
+	done    bool
+}
+
+//SearchPages returns a *SearchIterator over the entries under baseDN matching filter, retrieved pageSize entries at a time.
+//If baseDN is empty, Config.BaseDN is used. If pageSize is 0, Config.PageSize is used.
+//The iterator should be closed with Close if it isn't read to the end.
+func (c *Conn) SearchPages(baseDN, filter string, attrs []string, pageSize uint32) *SearchIterator {
+	if baseDN == "" {
+		baseDN = c.Config.BaseDN
+	}
+	if pageSize == 0 {
+		pageSize = c.Config.pageSize()
+	}
+	return c.newSearchIterator(baseDN, filter, attrs, 0, pageSize)
+}
+
+func (c *Conn) newSearchIterator(baseDN, filter string, attrs []string, sizeLimit int, pageSize uint32) *SearchIterator {
+	paging := ldap.NewControlPaging(pageSize)
+	return &SearchIterator{
+		conn: c,
+		request: ldap.NewSearchRequest(
+			baseDN,
+			ldap.ScopeWholeSubtree,
+			ldap.DerefAlways,
+			sizeLimit,
+			0,
+			false,
+			filter,
+			attrs,
+			[]ldap.Control{paging},
+		),
+		paging: paging,
+	}
+}
+
+//Next retrieves the next page of entries and returns true, or returns false if there are no more pages or an error occurred.
+func (it *SearchIterator) Next() bool {
+	if it.done {
+		return false
+	}
+
+	var result *ldap.SearchResult
+	err := it.conn.do(func() (err error) {
+		result, err = it.conn.Conn.Search(it.request)
+		return err
+	})
+	if err != nil {
+		it.entries = nil
+		it.err = fmt.Errorf(`Search error "%s": %w`, it.request.Filter, err)
+		it.done = true
+		return false
+	}
+
+	it.entries = result.Entries
+
+	var cookie []byte
+	if control, ok := ldap.FindControl(result.Controls, ldap.ControlTypePaging).(*ldap.ControlPaging); ok {
+		cookie = control.Cookie
+	}
+	if len(cookie) == 0 {
+		it.done = true
+	} else {
+		it.paging.SetCookie(cookie)
+	}
+
+	return true
+}
+
+//Entries returns the current page of entries.
+func (it *SearchIterator) Entries() []*ldap.Entry {
+	return it.entries
+}
+
+//Err returns the error that stopped iteration, if any.
+func (it *SearchIterator) Err() error {
+	return it.err
+}
+
+//Close tells the server to discard the rest of the results if the iterator wasn't read to the end,
+//or returns an error if one occurred.
+func (it *SearchIterator) Close() error {
+	if it.done {
+		return nil
+	}
+	it.done = true
+
+	if len(it.paging.Cookie) == 0 {
+		return nil
+	}
+
+	//a page size of 0 abandons the paged search
+	it.paging.PagingSize = 0
+	err := it.conn.do(func() error {
+		_, err := it.conn.Conn.Search(it.request)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf(`Search error "%s": %w`, it.request.Filter, err)
+	}
+
+	return nil
 }
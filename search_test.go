@@ -124,6 +124,119 @@ func TestConnSearchOne(t *testing.T) {
 	if _, err = conn.GetDN("cn", entry.GetAttributeValue("cn")); err != nil {
 		t.Fatal("GetDN: expected err to be nil but got:", err)
 	}
+
+	entry, err = conn.GetAttributes("userPrincipalName", testConfig.BindUPN, []string{"objectGUID", "objectSid"})
+	if err != nil {
+		t.Fatal("GetAttributes: expected err to be nil but got:", err)
+	}
+
+	var guid GUID
+	if err = guid.UnmarshalBinary(entry.GetRawAttributeValue("objectGUID")); err != nil {
+		t.Fatal("GUID: expected err to be nil but got:", err)
+	}
+
+	if dn, err := conn.GetDNByGUID(guid); err != nil || dn != entry.DN {
+		t.Errorf("GetDNByGUID: expected dn to be %s but got: %s, %v", entry.DN, dn, err)
+	}
+
+	sid := new(SID)
+	if err = sid.UnmarshalBinary(entry.GetRawAttributeValue("objectSid")); err != nil {
+		t.Fatal("SID: expected err to be nil but got:", err)
+	}
+
+	if dn, err := conn.GetDNBySID(sid); err != nil || dn != entry.DN {
+		t.Errorf("GetDNBySID: expected dn to be %s but got: %s, %v", entry.DN, dn, err)
+	}
+
+	if _, err = conn.GetDNByGUID(GUID{}); !strings.HasSuffix(err.Error(), "no entries returned") {
+		t.Error("GetDNByGUID: no entries: Expected no entries search error but got:", err)
+	}
+}
+
+func TestConnSearchPages(t *testing.T) {
+	if testConfig.Server == "" {
+		t.Skip("ADTEST_SERVER not set")
+		return
+	}
+
+	if testConfig.BindUPN == "" || testConfig.BindPass == "" {
+		t.Skip("ADTEST_BIND_UPN or ADTEST_BIND_PASS not set")
+		return
+	}
+
+	if testConfig.BaseDN == "" {
+		t.Skip("ADTEST_BASEDN not set")
+		return
+	}
+
+	config := &Config{Server: testConfig.Server, Port: testConfig.Port, Security: testConfig.BindSecurity, BaseDN: testConfig.BaseDN}
+	conn, err := config.Connect()
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Conn.Close()
+
+	status, err := conn.Bind(testConfig.BindUPN, testConfig.BindPass)
+	if err != nil {
+		t.Fatal("Error binding to server:", err)
+	}
+
+	if !status {
+		t.Fatal("Error binding to server: invalid credentials")
+	}
+
+	it := conn.SearchPages("", "invalid filter", []string{""}, 1)
+	if it.Next() {
+		t.Error("Invalid filter: Expected Next to be false")
+	}
+	if err = it.Err(); err == nil || !strings.Contains(err.Error(), "Filter Compile Error") {
+		t.Error("Invalid filter: Expected invalid filter search error but got:", err)
+	}
+
+	all, err := conn.Search("(objectClass=person)", []string{""}, 0)
+	if err != nil {
+		t.Fatal("Search: Expected err to be nil but got:", err)
+	}
+	if len(all) < 3 {
+		t.Skip("Not enough entries to test paging")
+		return
+	}
+
+	pages, count := 0, 0
+	it = conn.SearchPages("", "(objectClass=person)", []string{""}, 2)
+	for it.Next() {
+		if len(it.Entries()) > 2 {
+			t.Errorf("Expected page size to be at most 2 but got %d", len(it.Entries()))
+		}
+		pages++
+		count += len(it.Entries())
+	}
+	if err = it.Err(); err != nil {
+		t.Fatal("Paged search: Expected err to be nil but got:", err)
+	}
+	if pages < 2 || count != len(all) {
+		t.Errorf("Expected %d entries in multiple pages but got %d entries in %d pages", len(all), count, pages)
+	}
+
+	it = conn.SearchPages("", "(objectClass=person)", []string{""}, 1)
+	if !it.Next() {
+		t.Fatal("Abandon: Expected Next to be true but got:", it.Err())
+	}
+	if err = it.Close(); err != nil {
+		t.Error("Abandon: Expected err to be nil but got:", err)
+	}
+	if it.Next() {
+		t.Error("Abandon: Expected Next to be false after Close")
+	}
+
+	config.PageSize = 1
+	small, err := conn.Search("(objectClass=person)", []string{""}, 0)
+	if err != nil {
+		t.Fatal("Small pages: Expected err to be nil but got:", err)
+	}
+	if len(small) != len(all) {
+		t.Errorf("Small pages: Expected %d entries but got %d", len(all), len(small))
+	}
 }
 
 func TestGetGroups(t *testing.T) {
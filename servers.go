@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//server is a single server to connect to. host is used for TLS verification.
+type server struct {
+	host string
+	addr string
+}
+
+//serverHealth remembers which servers recently failed to connect, keyed by address.
+//It is shared between all Configs so a dead server is skipped no matter which Config is used to connect.
+var serverHealth = &healthTracker{failed: make(map[string]time.Time)}
+
+type healthTracker struct {
+	mu     sync.Mutex
+	failed map[string]time.Time
+}
+
+//fail marks addr as unhealthy until cooldown has passed.
+func (h *healthTracker) fail(addr string, cooldown time.Duration) {
+	if cooldown < 0 {
+		return
+	}
+	if cooldown == 0 {
+		cooldown = DefaultServerCooldown
+	}
+
+	h.mu.Lock()
+	h.failed[addr] = time.Now().Add(cooldown)
+	h.mu.Unlock()
+}
+
+//succeed marks addr as healthy.
+func (h *healthTracker) succeed(addr string) {
+	h.mu.Lock()
+	delete(h.failed, addr)
+	h.mu.Unlock()
+}
+
+//healthy returns false if addr failed within its cooldown period.
+func (h *healthTracker) healthy(addr string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	until, ok := h.failed[addr]
+	if !ok {
+		return true
+	}
+	if time.Now().After(until) {
+		delete(h.failed, addr)
+		return true
+	}
+	return false
+}
+
+//servers returns the servers to try, in order. Servers that recently failed are moved to the end of the list
+//so they are still tried if no other server is available.
+func (c *Config) servers() []server {
+	var hosts []string
+	if c.Server != "" || len(c.Servers) == 0 {
+		hosts = append(hosts, c.Server)
+	}
+	hosts = append(hosts, c.Servers...)
+
+	list := make([]server, 0, len(hosts))
+	for _, h := range hosts {
+		host, port, err := net.SplitHostPort(h)
+		if err != nil {
+			host, port = h, strconv.Itoa(c.Port)
+		}
+		list = append(list, server{host: host, addr: net.JoinHostPort(host, port)})
+	}
+
+	if c.Selection == SelectRandom {
+		rand.Shuffle(len(list), func(i, j int) { list[i], list[j] = list[j], list[i] })
+	}
+
+	ordered := make([]server, 0, len(list))
+	var failed []server
+	for _, s := range list {
+		if serverHealth.healthy(s.addr) {
+			ordered = append(ordered, s)
+		} else {
+			failed = append(failed, s)
+		}
+	}
+
+	return append(ordered, failed...)
+}
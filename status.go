@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+//AccountStatus describes the password and account state of a user.
+type AccountStatus struct {
+	//PasswordLastSet is the zero time.Time if the user must change their password at next logon or pwdLastSet can't be read.
+	PasswordLastSet time.Time
+	//PasswordExpires is when the password expires, or the zero time.Time if it never expires.
+	PasswordExpires      time.Time
+	PasswordNeverExpires bool
+	PasswordMustChange   bool
+	PasswordExpired      bool
+
+	Disabled bool
+	Locked   bool
+	//LockoutTime is when the account was locked, or the zero time.Time if it isn't locked.
+	LockoutTime time.Time
+	Expired     bool
+	//AccountExpires is when the account expires, or the zero time.Time if it never expires.
+	AccountExpires time.Time
+
+	BadPasswordCount int
+	BadPasswordTime  time.Time
+}
+
+//accountStatusEntry holds the attributes AccountStatus is computed from.
+type accountStatusEntry struct {
+	PwdLastSet         *time.Time         `ad:"pwdLastSet"`
+	UserAccountControl UserAccountControl `ad:"userAccountControl"`
+	AccountExpires     time.Time          `ad:"accountExpires"`
+	LockoutTime        time.Time          `ad:"lockoutTime"`
+	BadPwdCount        int                `ad:"badPwdCount"`
+	BadPasswordTime    time.Time          `ad:"badPasswordTime"`
+	//constructed attributes, which are missing on servers older than Windows Server 2008
+	ComputedUAC    *UserAccountControl `ad:"msDS-User-Account-Control-Computed"`
+	ComputedExpiry *string             `ad:"msDS-UserPasswordExpiryTimeComputed"`
+}
+
+//AccountStatus returns the password and account state of the user with the given DN or returns an error if one occurred.
+//Password expiry and lockout are read from the server's constructed attributes, which take fine-grained password policies into account.
+//On servers that don't support them, they are computed from the user's password policy (see PasswordPolicy) instead,
+//or the domain's password policy if the user's can't be read.
+func (c *Conn) AccountStatus(dn string) (*AccountStatus, error) {
+	var e accountStatusEntry
+	entry, err := c.getEntry(dn, attributesOf(reflect.TypeOf(e)))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = UnmarshalEntry(entry, &e); err != nil {
+		return nil, err
+	}
+
+	var policy *PasswordPolicy
+	if e.ComputedUAC == nil || e.ComputedExpiry == nil {
+		//PSOs usually can't be read by the users they apply to
+		if policy, err = c.PasswordPolicy(dn); err != nil {
+			if policy, err = c.DomainPasswordPolicy(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return e.status(policy, time.Now())
+}
+
+//status returns the AccountStatus at now. policy is only used if the constructed attributes are missing.
+func (e *accountStatusEntry) status(policy *PasswordPolicy, now time.Time) (*AccountStatus, error) {
+	s := &AccountStatus{
+		PasswordNeverExpires: e.UserAccountControl.Has(UACDontExpirePassword),
+		Disabled:             e.UserAccountControl.Has(UACAccountDisable),
+		AccountExpires:       e.AccountExpires,
+		BadPasswordCount:     e.BadPwdCount,
+		BadPasswordTime:      e.BadPasswordTime,
+	}
+
+	//pwdLastSet is 0 if the password must be changed, and missing if it can't be read
+	if e.PwdLastSet != nil {
+		s.PasswordLastSet = *e.PwdLastSet
+		s.PasswordMustChange = e.PwdLastSet.IsZero()
+	}
+
+	s.Expired = !s.AccountExpires.IsZero() && !now.Before(s.AccountExpires)
+
+	if e.ComputedUAC != nil {
+		s.Locked = e.ComputedUAC.Has(UACLockout)
+	} else {
+		//lockoutTime isn't reset when the lockout duration passes
+		s.Locked = !e.LockoutTime.IsZero() &&
+			(policy.LockoutDuration == 0 || now.Before(e.LockoutTime.Add(policy.LockoutDuration)))
+	}
+	if s.Locked {
+		s.LockoutTime = e.LockoutTime
+	}
+
+	if e.ComputedExpiry != nil {
+		ft, err := strconv.ParseInt(*e.ComputedExpiry, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf(`Parse error: invalid msDS-UserPasswordExpiryTimeComputed ("%s"): %w`, *e.ComputedExpiry, err)
+		}
+		//0 means the password must be changed now, which is reported with PasswordMustChange
+		if ft != FileTimeNeverMax {
+			s.PasswordExpires = FileTimeToTime(ft)
+		}
+	} else if !s.PasswordNeverExpires && !s.PasswordLastSet.IsZero() && policy.MaxPasswordAge != 0 {
+		s.PasswordExpires = s.PasswordLastSet.Add(policy.MaxPasswordAge)
+	}
+
+	s.PasswordExpired = s.PasswordMustChange || (!s.PasswordExpires.IsZero() && !now.Before(s.PasswordExpires))
+
+	return s, nil
+}
@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+func TestAccountStatus(t *testing.T) {
+	now := time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC)
+	lastSet := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	policy := &PasswordPolicy{MaxPasswordAge: 42 * 24 * time.Hour, LockoutDuration: 30 * time.Minute}
+	ft := func(t time.Time) string {
+		return strconv.FormatInt(TimeToFileTime(t), 10)
+	}
+
+	tests := []struct {
+		name   string
+		attrs  map[string][]string
+		policy *PasswordPolicy
+		want   AccountStatus
+	}{
+		{
+			name: "computed",
+			attrs: map[string][]string{
+				"pwdLastSet":                          {ft(lastSet)},
+				"userAccountControl":                  {"512"},
+				"msDS-User-Account-Control-Computed":  {"16"},
+				"msDS-UserPasswordExpiryTimeComputed": {ft(time.Date(2023, 11, 12, 0, 0, 0, 0, time.UTC))},
+				"accountExpires":                      {"9223372036854775807"},
+				"lockoutTime":                         {ft(time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC))},
+				"badPwdCount":                         {"5"},
+				"badPasswordTime":                     {ft(time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC))},
+			},
+			want: AccountStatus{
+				PasswordLastSet:  lastSet,
+				PasswordExpires:  time.Date(2023, 11, 12, 0, 0, 0, 0, time.UTC),
+				Locked:           true,
+				LockoutTime:      time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC),
+				BadPasswordCount: 5,
+				BadPasswordTime:  time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "computed never expires",
+			attrs: map[string][]string{
+				"pwdLastSet":                          {ft(lastSet)},
+				"userAccountControl":                  {"66050"},
+				"msDS-User-Account-Control-Computed":  {"0"},
+				"msDS-UserPasswordExpiryTimeComputed": {"9223372036854775807"},
+				"accountExpires":                      {ft(time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC))},
+				"lockoutTime":                         {"0"},
+			},
+			want: AccountStatus{
+				PasswordLastSet:      lastSet,
+				PasswordNeverExpires: true,
+				Disabled:             true,
+				Expired:              true,
+				AccountExpires:       time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "computed must change",
+			attrs: map[string][]string{
+				"pwdLastSet":                          {"0"},
+				"userAccountControl":                  {"512"},
+				"msDS-User-Account-Control-Computed":  {"8388608"},
+				"msDS-UserPasswordExpiryTimeComputed": {"0"},
+			},
+			want: AccountStatus{
+				PasswordMustChange: true,
+				PasswordExpired:    true,
+			},
+		},
+		{
+			name: "policy expired and lockout passed",
+			attrs: map[string][]string{
+				"pwdLastSet":         {ft(lastSet)},
+				"userAccountControl": {"512"},
+				"lockoutTime":        {ft(time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC))},
+			},
+			policy: &PasswordPolicy{MaxPasswordAge: 7 * 24 * time.Hour, LockoutDuration: 30 * time.Minute},
+			want: AccountStatus{
+				PasswordLastSet: lastSet,
+				PasswordExpires: lastSet.Add(7 * 24 * time.Hour),
+				PasswordExpired: true,
+			},
+		},
+		{
+			name: "policy locked until unlocked",
+			attrs: map[string][]string{
+				"pwdLastSet":         {ft(lastSet)},
+				"userAccountControl": {"512"},
+				"lockoutTime":        {ft(time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC))},
+			},
+			policy: &PasswordPolicy{MaxPasswordAge: 42 * 24 * time.Hour},
+			want: AccountStatus{
+				PasswordLastSet: lastSet,
+				PasswordExpires: time.Date(2023, 11, 12, 0, 0, 0, 0, time.UTC),
+				Locked:          true,
+				LockoutTime:     time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "computed pwdLastSet unreadable",
+			attrs: map[string][]string{
+				"userAccountControl":                  {"512"},
+				"msDS-User-Account-Control-Computed":  {"0"},
+				"msDS-UserPasswordExpiryTimeComputed": {ft(time.Date(2023, 11, 12, 0, 0, 0, 0, time.UTC))},
+			},
+			want: AccountStatus{
+				PasswordExpires: time.Date(2023, 11, 12, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "policy must change",
+			attrs: map[string][]string{
+				"pwdLastSet":         {"0"},
+				"userAccountControl": {"512"},
+			},
+			policy: policy,
+			want: AccountStatus{
+				PasswordMustChange: true,
+				PasswordExpired:    true,
+			},
+		},
+		{
+			name: "policy pwdLastSet unreadable",
+			attrs: map[string][]string{
+				"userAccountControl": {"512"},
+			},
+			policy: policy,
+			want:   AccountStatus{},
+		},
+		{
+			name: "policy never expires",
+			attrs: map[string][]string{
+				"pwdLastSet":         {ft(lastSet)},
+				"userAccountControl": {"66048"},
+			},
+			policy: policy,
+			want: AccountStatus{
+				PasswordLastSet:      lastSet,
+				PasswordNeverExpires: true,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		var e accountStatusEntry
+		if err := UnmarshalEntry(ldap.NewEntry("CN=Test,DC=example,DC=com", test.attrs), &e); err != nil {
+			t.Fatalf("%s: Expected err to be nil but got: %v", test.name, err)
+		}
+
+		status, err := e.status(test.policy, now)
+		if err != nil {
+			t.Fatalf("%s: Expected err to be nil but got: %v", test.name, err)
+		}
+
+		if *status != test.want {
+			t.Errorf("%s: Expected status to be %+v but got %+v", test.name, test.want, *status)
+		}
+	}
+}
+
+func TestConnAccountStatus(t *testing.T) {
+	if testConfig.Server == "" {
+		t.Skip("ADTEST_SERVER not set")
+		return
+	}
+
+	if testConfig.BindUPN == "" || testConfig.BindPass == "" {
+		t.Skip("ADTEST_BIND_UPN or ADTEST_BIND_PASS not set")
+		return
+	}
+
+	if testConfig.BaseDN == "" {
+		t.Skip("ADTEST_BASEDN not set")
+		return
+	}
+
+	config := &Config{Server: testConfig.Server, Port: testConfig.Port, Security: testConfig.BindSecurity, BaseDN: testConfig.BaseDN}
+	conn, err := config.Connect()
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Conn.Close()
+
+	status, err := conn.Bind(testConfig.BindUPN, testConfig.BindPass)
+	if err != nil {
+		t.Fatal("Error binding to server:", err)
+	}
+
+	if !status {
+		t.Fatal("Error binding to server: invalid credentials")
+	}
+
+	dn, err := conn.GetDN("userPrincipalName", testConfig.BindUPN)
+	if err != nil {
+		t.Fatal("Error getting user DN:", err)
+	}
+
+	account, err := conn.AccountStatus(dn)
+	if err != nil {
+		t.Fatal("Expected err to be nil but got:", err)
+	}
+
+	if account.Disabled || account.Locked || account.Expired || account.PasswordExpired {
+		t.Errorf("Expected bound user to be usable but got %+v", *account)
+	}
+}
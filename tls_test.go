@@ -0,0 +1,303 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+//testCertificate returns a self-signed certificate for host.
+func testCertificate(t *testing.T, host string) tls.Certificate {
+	return testIssuedCertificate(t, host, nil)
+}
+
+//testIssuedCertificate returns a certificate for host issued by parent, or a self-signed certificate if parent is nil.
+//The returned chain includes parent.
+func testIssuedCertificate(t *testing.T, host string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Error generating key:", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: host},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	issuer, signer := template, crypto.Signer(key)
+	if parent != nil {
+		issuer, signer = parent.Leaf, parent.PrivateKey.(crypto.Signer)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal("Error creating certificate:", err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal("Error parsing certificate:", err)
+	}
+
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+	if parent != nil {
+		cert.Certificate = append(cert.Certificate, parent.Certificate...)
+	}
+	return cert
+}
+
+//ldapResponse returns an LDAP response message with the given operation tag and result code.
+func ldapResponse(id int64, tag ber.Tag, code int64, extra ...*ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	for _, p := range extra {
+		op.AppendChild(p)
+	}
+	packet.AppendChild(op)
+
+	return packet
+}
+
+//serveLDAP answers requests on conn until it's closed: binds succeed and extended requests are answered as WhoAmI with authzid.
+func serveLDAP(conn net.Conn, authzid string) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+
+		var resp *ber.Packet
+		switch packet.Children[1].Tag {
+		case ldap.ApplicationBindRequest:
+			resp = ldapResponse(id, ldap.ApplicationBindResponse, ldap.LDAPResultSuccess)
+		case ldap.ApplicationExtendedRequest:
+			resp = ldapResponse(id, ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess,
+				ber.NewString(ber.ClassContext, ber.TypePrimitive, 11, authzid, ""))
+		default:
+			return
+		}
+
+		if _, err = conn.Write(resp.Bytes()); err != nil {
+			return
+		}
+	}
+}
+
+func TestConnExternalBind(t *testing.T) {
+	serverCert := testCertificate(t, "127.0.0.1")
+	clientCert := testCertificate(t, "svc-app")
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{serverCert}, ClientAuth: tls.RequireAnyClientCert})
+	if err != nil {
+		t.Fatal("Error starting listener:", err)
+	}
+	defer l.Close()
+
+	clients := make(chan string, 2)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			tlsConn := conn.(*tls.Conn)
+			if err = tlsConn.Handshake(); err != nil {
+				clients <- ""
+				conn.Close()
+				continue
+			}
+			clients <- tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName
+			go serveLDAP(conn, `u:CORP\svc-app`)
+		}
+	}()
+
+	config := &Config{Servers: []string{l.Addr().String()}, Security: SecurityInsecureTLS, Certificates: []tls.Certificate{clientCert}}
+	conn, err := config.Connect()
+	if err != nil {
+		t.Fatal("Certificates: Expected connect error to be nil but got:", err)
+	}
+	defer conn.Conn.Close()
+
+	if cn := <-clients; cn != "svc-app" {
+		t.Errorf("Certificates: Expected client certificate svc-app but got: %q", cn)
+	}
+
+	if err = conn.ExternalBind(); err != nil {
+		t.Fatal("ExternalBind: Expected err to be nil but got:", err)
+	}
+	if identity := conn.boundAs(); identity != `u:CORP\svc-app` {
+		t.Errorf("ExternalBind: Expected identity %q but got: %q", `u:CORP\svc-app`, identity)
+	}
+
+	called := false
+	config = &Config{Servers: []string{l.Addr().String()}, Security: SecurityInsecureTLS}
+	config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		called = true
+		return &clientCert, nil
+	}
+	conn2, err := config.Connect()
+	if err != nil {
+		t.Fatal("GetClientCertificate: Expected connect error to be nil but got:", err)
+	}
+	defer conn2.Conn.Close()
+
+	if cn := <-clients; !called || cn != "svc-app" {
+		t.Errorf("GetClientCertificate: Expected callback's certificate to be used but got: %v, %q", called, cn)
+	}
+
+	plain, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error starting listener:", err)
+	}
+	defer plain.Close()
+
+	config = &Config{Servers: []string{plain.Addr().String()}, Security: SecurityNone}
+	conn3, err := config.Connect()
+	if err != nil {
+		t.Fatal("SecurityNone: Expected connect error to be nil but got:", err)
+	}
+	defer conn3.Conn.Close()
+
+	if err = conn3.ExternalBind(); err == nil {
+		t.Error("SecurityNone: Expected ExternalBind error but got nil")
+	}
+}
+
+//listenLDAP starts a listener that answers requests with serveLDAP. If startTLS is true, connections start in plaintext
+//and are upgraded with config after a StartTLS request; otherwise they use TLS from the start.
+func listenLDAP(t *testing.T, config *tls.Config, startTLS bool) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error starting listener:", err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			if !startTLS {
+				go serveLDAP(tls.Server(conn, config), "")
+				continue
+			}
+
+			go func() {
+				packet, err := ber.ReadPacket(conn)
+				if err != nil || len(packet.Children) < 2 || packet.Children[1].Tag != ldap.ApplicationExtendedRequest {
+					conn.Close()
+					return
+				}
+				resp := ldapResponse(packet.Children[0].Value.(int64), ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess)
+				if _, err = conn.Write(resp.Bytes()); err != nil {
+					conn.Close()
+					return
+				}
+				serveLDAP(tls.Server(conn, config), "")
+			}()
+		}
+	}()
+
+	return l
+}
+
+func TestConfigTLSConfig(t *testing.T) {
+	serverCert := testCertificate(t, "dc1.example.com")
+	pool := x509.NewCertPool()
+	pool.AddCert(serverCert.Leaf)
+	otherPool := x509.NewCertPool()
+	otherPool.AddCert(testCertificate(t, "dc1.example.com").Leaf)
+
+	base := &tls.Config{RootCAs: otherPool, MinVersion: tls.VersionTLS13, ServerName: "base.example.com"}
+	config := &Config{Security: SecurityInsecureStartTLS, TLSConfig: base, RootCAs: pool, ServerName: "dc1.example.com"}
+	tlsConfig := config.tlsConfig(server{host: "10.0.0.1"})
+	if tlsConfig.RootCAs != pool || tlsConfig.MinVersion != tls.VersionTLS13 || tlsConfig.ServerName != "dc1.example.com" || !tlsConfig.InsecureSkipVerify {
+		t.Errorf("tlsConfig: Expected fields to be merged but got: %#v", tlsConfig)
+	}
+	if base.RootCAs != otherPool || base.ServerName != "base.example.com" || base.InsecureSkipVerify {
+		t.Error("tlsConfig: Expected TLSConfig not to be modified")
+	}
+
+	tls12 := listenLDAP(t, &tls.Config{Certificates: []tls.Certificate{serverCert}, MaxVersion: tls.VersionTLS12}, false)
+	defer tls12.Close()
+	tls13 := listenLDAP(t, &tls.Config{Certificates: []tls.Certificate{serverCert}}, false)
+	defer tls13.Close()
+	startTLS := listenLDAP(t, &tls.Config{Certificates: []tls.Certificate{serverCert}}, true)
+	defer startTLS.Close()
+
+	type test struct {
+		name    string
+		config  *Config
+		success bool
+		version uint16
+	}
+
+	tests := []test{
+		{"IP without ServerName", &Config{Servers: []string{tls13.Addr().String()}, Security: SecurityTLS, RootCAs: pool}, false, 0},
+		{"ServerName", &Config{Servers: []string{tls13.Addr().String()}, Security: SecurityTLS, RootCAs: pool, ServerName: "dc1.example.com"}, true, tls.VersionTLS13},
+		{"Wrong ServerName", &Config{Servers: []string{tls13.Addr().String()}, Security: SecurityTLS, RootCAs: pool, ServerName: "dc2.example.com"}, false, 0},
+		{"TLSConfig", &Config{Servers: []string{tls13.Addr().String()}, Security: SecurityTLS,
+			TLSConfig: &tls.Config{RootCAs: pool, ServerName: "dc1.example.com", MaxVersion: tls.VersionTLS12}}, true, tls.VersionTLS12},
+		{"TLSConfig MinVersion", &Config{Servers: []string{tls12.Addr().String()}, Security: SecurityTLS,
+			TLSConfig: &tls.Config{RootCAs: pool, ServerName: "dc1.example.com", MinVersion: tls.VersionTLS13}}, false, 0},
+		{"Insecure MinVersion", &Config{Servers: []string{tls12.Addr().String()}, Security: SecurityInsecureTLS,
+			TLSConfig: &tls.Config{MinVersion: tls.VersionTLS13}}, false, 0},
+		{"StartTLS", &Config{Servers: []string{startTLS.Addr().String()}, Security: SecurityStartTLS, ServerName: "dc1.example.com",
+			TLSConfig: &tls.Config{RootCAs: pool, MaxVersion: tls.VersionTLS12}}, true, tls.VersionTLS12},
+		{"StartTLS untrusted", &Config{Servers: []string{startTLS.Addr().String()}, Security: SecurityStartTLS, ServerName: "dc1.example.com",
+			TLSConfig: &tls.Config{RootCAs: otherPool}}, false, 0},
+	}
+
+	for _, test := range tests {
+		conn, err := test.config.Connect()
+		if !test.success {
+			if err == nil {
+				conn.Conn.Close()
+				t.Errorf("%s: Expected connect error but got nil", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Expected connect error to be nil but got: %v", test.name, err)
+			continue
+		}
+
+		if state, ok := conn.Conn.TLSConnectionState(); !ok || state.Version != test.version {
+			t.Errorf("%s: Expected TLS version %#x but got: %#x", test.name, test.version, state.Version)
+		}
+		if conn.host != "dc1.example.com" {
+			t.Errorf("%s: Expected host %q but got: %q", test.name, "dc1.example.com", conn.host)
+		}
+		conn.Conn.Close()
+	}
+}
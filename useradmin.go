@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+//CreateUser creates a user with the given cn and sAMAccountName in the container or OU with the given DN
+//and returns the new user's DN, or returns an error if one occurred.
+//The userPrincipalName is derived from username with Config.UPN. attrs holds any other attributes to set, e.g. givenName or mail.
+//If password is empty, the account is created disabled; otherwise it's created enabled with the given password,
+//which requires an encrypted connection.
+func (c *Conn) CreateUser(parentDN, name, username, password string, attrs map[string][]string) (string, error) {
+	upn, err := c.Config.UPN(username)
+	if err != nil {
+		return "", err
+	}
+
+	dn := fmt.Sprintf("CN=%s,%s", escapeDN(name), parentDN)
+
+	req := ldap.NewAddRequest(dn, nil)
+	req.Attribute("objectClass", []string{"top", "person", "organizationalPerson", "user"})
+	req.Attribute("sAMAccountName", []string{username})
+	req.Attribute("userPrincipalName", []string{upn})
+	for attr, values := range attrs {
+		req.Attribute(attr, values)
+	}
+
+	uac := UACNormalAccount | UACAccountDisable
+	if password != "" {
+		encoded, err := encodePassword(password)
+		if err != nil {
+			return "", fmt.Errorf("User error: Unable to encode password: %w", err)
+		}
+		req.Attribute("unicodePwd", []string{encoded})
+		uac = UACNormalAccount
+	}
+	req.Attribute("userAccountControl", []string{strconv.FormatUint(uint64(uac), 10)})
+
+	err = c.do(func() error {
+		return c.Conn.Add(req)
+	})
+	if err != nil {
+		return "", fmt.Errorf("User error: Unable to create user (%s): %w", dn, newModifyError(err))
+	}
+
+	return dn, nil
+}
+
+//DeleteUser deletes the user with the given DN or returns an error if one occurred.
+func (c *Conn) DeleteUser(dn string) error {
+	req := ldap.NewDelRequest(dn, nil)
+	err := c.do(func() error {
+		return c.Conn.Del(req)
+	})
+	if err != nil {
+		return fmt.Errorf("User error: Unable to delete user (%s): %w", dn, newModifyError(err))
+	}
+
+	return nil
+}
+
+//ModifyUserAccountControl sets the flags in set and clears the flags in clear on the userAccountControl attribute
+//of the object with the given DN, or returns an error if one occurred.
+func (c *Conn) ModifyUserAccountControl(dn string, set, clear UserAccountControl) error {
+	entry, err := c.getEntry(dn, []string{"userAccountControl"})
+	if err != nil {
+		return err
+	}
+
+	uac, err := GetUserAccountControl(entry)
+	if err != nil {
+		return fmt.Errorf("User error: Unable to read userAccountControl (%s): %w", dn, err)
+	}
+
+	return c.replace(dn, "userAccountControl", strconv.FormatUint(uint64((uac|set)&^clear), 10))
+}
+
+//EnableUser enables the account with the given DN or returns an error if one occurred.
+func (c *Conn) EnableUser(dn string) error {
+	return c.ModifyUserAccountControl(dn, 0, UACAccountDisable)
+}
+
+//DisableUser disables the account with the given DN or returns an error if one occurred.
+func (c *Conn) DisableUser(dn string) error {
+	return c.ModifyUserAccountControl(dn, UACAccountDisable, 0)
+}
+
+//UnlockUser unlocks the account with the given DN, by clearing lockoutTime, or returns an error if one occurred.
+func (c *Conn) UnlockUser(dn string) error {
+	return c.replace(dn, "lockoutTime", "0")
+}
+
+//SetAccountExpires sets when the account with the given DN expires or returns an error if one occurred.
+//If expires is the zero time.Time, the account never expires.
+func (c *Conn) SetAccountExpires(dn string, expires time.Time) error {
+	return c.replace(dn, "accountExpires", strconv.FormatInt(TimeToFileTime(expires), 10))
+}
+
+//SetPasswordMustChange sets whether the user with the given DN must change their password at next logon,
+//or returns an error if one occurred. If mustChange is false, the password's age starts over at the current time.
+func (c *Conn) SetPasswordMustChange(dn string, mustChange bool) error {
+	//pwdLastSet can only be set to 0 (must change) or -1 (now)
+	if mustChange {
+		return c.replace(dn, "pwdLastSet", "0")
+	}
+	return c.replace(dn, "pwdLastSet", "-1")
+}
+
+//MoveObject moves the object with the given DN into the container or OU with the given DN, keeping its name,
+//and returns the object's new DN, or returns an error if one occurred.
+func (c *Conn) MoveObject(dn, parentDN string) (string, error) {
+	rdn, _ := splitDN(dn)
+	return c.modifyDN(dn, rdn, parentDN)
+}
+
+//RenameObject changes the cn of the object with the given DN to name and returns the object's new DN,
+//or returns an error if one occurred. Other naming attributes, e.g. sAMAccountName, are not changed.
+func (c *Conn) RenameObject(dn, name string) (string, error) {
+	_, parentDN := splitDN(dn)
+	return c.modifyDN(dn, "CN="+escapeDN(name), parentDN)
+}
+
+func (c *Conn) modifyDN(dn, rdn, parentDN string) (string, error) {
+	req := ldap.NewModifyDNRequest(dn, rdn, true, parentDN)
+	err := c.do(func() error {
+		return c.Conn.ModifyDN(req)
+	})
+	if err != nil {
+		return "", fmt.Errorf("Modify error: Unable to move %s to %s,%s: %w", dn, rdn, parentDN, newModifyError(err))
+	}
+
+	return rdn + "," + parentDN, nil
+}
+
+//replace replaces the value of attr for the object with the given DN or returns an error if one occurred.
+func (c *Conn) replace(dn, attr, value string) error {
+	req := ldap.NewModifyRequest(dn, nil)
+	req.Replace(attr, []string{value})
+
+	err := c.do(func() error {
+		return c.Conn.Modify(req)
+	})
+	if err != nil {
+		return fmt.Errorf("Modify error: Unable to set %s (%s): %w", attr, dn, newModifyError(err))
+	}
+
+	return nil
+}
+
+//splitDN splits dn into its first RDN and its parent's DN.
+func splitDN(dn string) (rdn, parent string) {
+	for idx := 0; idx < len(dn); idx++ {
+		switch dn[idx] {
+		case '\\':
+			idx++
+		case ',':
+			return dn[:idx], strings.TrimSpace(dn[idx+1:])
+		}
+	}
+	return dn, ""
+}
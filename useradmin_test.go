@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSplitDN(t *testing.T) {
+	tests := []struct {
+		dn     string
+		rdn    string
+		parent string
+	}{
+		{"CN=John Doe,OU=Users,DC=example,DC=com", "CN=John Doe", "OU=Users,DC=example,DC=com"},
+		{`CN=Doe\, John,OU=Users,DC=example,DC=com`, `CN=Doe\, John`, "OU=Users,DC=example,DC=com"},
+		{`CN=Back\\,DC=com`, `CN=Back\\`, "DC=com"},
+		{"CN=John Doe, OU=Users", "CN=John Doe", "OU=Users"},
+		{"DC=com", "DC=com", ""},
+	}
+
+	for _, test := range tests {
+		rdn, parent := splitDN(test.dn)
+		if rdn != test.rdn || parent != test.parent {
+			t.Errorf("expected split %s to be equal: want: %s | %s, have: %s | %s", test.dn, test.rdn, test.parent, rdn, parent)
+		}
+	}
+}
+
+func TestConnUserAdmin(t *testing.T) {
+	if testConfig.Server == "" {
+		t.Skip("ADTEST_SERVER not set")
+		return
+	}
+
+	if testConfig.BindUPN == "" || testConfig.BindPass == "" {
+		t.Skip("ADTEST_BIND_UPN or ADTEST_BIND_PASS not set")
+		return
+	}
+
+	if testConfig.BaseDN == "" {
+		t.Skip("ADTEST_BASEDN not set")
+		return
+	}
+
+	if testConfig.AdminOU == "" {
+		t.Skip("ADTEST_ADMIN_OU not set")
+		return
+	}
+
+	config := &Config{Server: testConfig.Server, Port: testConfig.Port, Security: testConfig.BindSecurity, BaseDN: testConfig.BaseDN}
+	conn, err := config.Connect()
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Conn.Close()
+
+	status, err := conn.Bind(testConfig.BindUPN, testConfig.BindPass)
+	if err != nil {
+		t.Fatal("Error binding to server:", err)
+	}
+
+	if !status {
+		t.Fatal("Error binding to server: invalid credentials")
+	}
+
+	username := fmt.Sprintf("gotest%d", time.Now().Unix()%1000000)
+	dn, err := conn.CreateUser(testConfig.AdminOU, "Test, "+username, username, "", map[string][]string{"givenName": {"Test"}})
+	if err != nil {
+		t.Fatal("CreateUser: Expected err to be nil but got:", err)
+	}
+	defer func() {
+		if err := conn.DeleteUser(dn); err != nil {
+			t.Error("DeleteUser: Expected err to be nil but got:", err)
+		}
+	}()
+
+	getUser := func() *User {
+		user := new(User)
+		if err := conn.GetObject("sAMAccountName", username, user); err != nil {
+			t.Fatal("GetObject: Expected err to be nil but got:", err)
+		}
+		return user
+	}
+
+	if user := getUser(); !user.UserAccountControl.Has(UACAccountDisable) || user.GivenName != "Test" {
+		t.Error("CreateUser: Expected user to be disabled with givenName set but got:", user.UserAccountControl, user.GivenName)
+	}
+
+	if err = conn.ModifyDNPassword(dn, "Go-AD-Auth-Test-1"); err != nil {
+		t.Fatal("ModifyDNPassword: Expected err to be nil but got:", err)
+	}
+
+	if err = conn.EnableUser(dn); err != nil {
+		t.Fatal("EnableUser: Expected err to be nil but got:", err)
+	}
+
+	if user := getUser(); user.UserAccountControl.Has(UACAccountDisable) {
+		t.Error("EnableUser: Expected user to be enabled but got:", user.UserAccountControl)
+	}
+
+	if err = conn.DisableUser(dn); err != nil {
+		t.Fatal("DisableUser: Expected err to be nil but got:", err)
+	}
+
+	if user := getUser(); !user.UserAccountControl.Has(UACAccountDisable) {
+		t.Error("DisableUser: Expected user to be disabled but got:", user.UserAccountControl)
+	}
+
+	if err = conn.UnlockUser(dn); err != nil {
+		t.Error("UnlockUser: Expected err to be nil but got:", err)
+	}
+
+	expires := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	if err = conn.SetAccountExpires(dn, expires); err != nil {
+		t.Fatal("SetAccountExpires: Expected err to be nil but got:", err)
+	}
+
+	if user := getUser(); !user.AccountExpires.Equal(expires) {
+		t.Errorf("SetAccountExpires: Expected accountExpires to be %v but got: %v", expires, user.AccountExpires)
+	}
+
+	if err = conn.SetAccountExpires(dn, time.Time{}); err != nil {
+		t.Fatal("SetAccountExpires (never): Expected err to be nil but got:", err)
+	}
+
+	if user := getUser(); !user.AccountExpires.IsZero() {
+		t.Error("SetAccountExpires (never): Expected accountExpires to be never but got:", user.AccountExpires)
+	}
+
+	if err = conn.SetPasswordMustChange(dn, true); err != nil {
+		t.Fatal("SetPasswordMustChange: Expected err to be nil but got:", err)
+	}
+
+	if user := getUser(); !user.PwdLastSet.IsZero() {
+		t.Error("SetPasswordMustChange: Expected pwdLastSet to be 0 but got:", user.PwdLastSet)
+	}
+
+	if err = conn.SetPasswordMustChange(dn, false); err != nil {
+		t.Fatal("SetPasswordMustChange (false): Expected err to be nil but got:", err)
+	}
+
+	if user := getUser(); user.PwdLastSet.IsZero() {
+		t.Error("SetPasswordMustChange (false): Expected pwdLastSet to be set")
+	}
+
+	if dn, err = conn.RenameObject(dn, "Renamed "+username); err != nil {
+		t.Fatal("RenameObject: Expected err to be nil but got:", err)
+	}
+
+	if user := getUser(); user.DN != dn {
+		t.Errorf("RenameObject: Expected DN to be %s but got: %s", dn, user.DN)
+	}
+
+	if dn, err = conn.MoveObject(dn, testConfig.AdminOU); err != nil {
+		t.Fatal("MoveObject: Expected err to be nil but got:", err)
+	}
+
+	if user := getUser(); user.DN != dn {
+		t.Errorf("MoveObject: Expected DN to be %s but got: %s", dn, user.DN)
+	}
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+//ErrUnknownDomain is returned when a NetBIOS domain name can't be mapped to a DNS domain.
+var ErrUnknownDomain = errors.New("unknown NetBIOS domain")
+
+//UsernameFormat is the format a username was given in.
+type UsernameFormat int
+
+//Username formats understood by ParseUsername.
+const (
+	//UsernameSAMAccountName is a bare sAMAccountName, e.g. "jdoe".
+	UsernameSAMAccountName UsernameFormat = iota
+	//UsernameUPN is a userPrincipalName, e.g. "jdoe@example.com". The suffix may differ from the domain.
+	UsernameUPN
+	//UsernameDownLevel is a down-level logon name, e.g. "CORP\jdoe", or a username with a NetBIOS domain name, e.g. "jdoe@CORP".
+	UsernameDownLevel
+)
+
+//Username is a parsed username.
+type Username struct {
+	Format UsernameFormat
+	//User is the username without any domain.
+	User string
+	//Domain is the UPN suffix for UsernameUPN, the NetBIOS domain name for UsernameDownLevel, or empty for UsernameSAMAccountName.
+	Domain string
+}
+
+//String returns the username in its original format.
+func (u *Username) String() string {
+	switch u.Format {
+	case UsernameUPN:
+		return u.User + "@" + u.Domain
+	case UsernameDownLevel:
+		return u.Domain + `\` + u.User
+	default:
+		return u.User
+	}
+}
+
+//ParseUsername parses a username given as a sAMAccountName ("jdoe"), a down-level logon name ("CORP\jdoe"),
+//or a userPrincipalName ("jdoe@example.com"). A suffix without any dots ("jdoe@CORP") is treated as a NetBIOS domain name.
+func ParseUsername(username string) (*Username, error) {
+	if idx := strings.Index(username, `\`); idx != -1 {
+		u := &Username{Format: UsernameDownLevel, Domain: username[:idx], User: username[idx+1:]}
+		if u.Domain == "" || u.User == "" || strings.ContainsAny(u.User, `\@`) {
+			return nil, fmt.Errorf(`Parse error: invalid down-level logon name "%s"`, username)
+		}
+		return u, nil
+	}
+
+	if idx := strings.LastIndex(username, "@"); idx != -1 {
+		u := &Username{Format: UsernameUPN, User: username[:idx], Domain: username[idx+1:]}
+		if u.User == "" || u.Domain == "" {
+			return nil, fmt.Errorf(`Parse error: invalid userPrincipalName "%s"`, username)
+		}
+		if !strings.Contains(u.Domain, ".") {
+			u.Format = UsernameDownLevel
+		}
+		return u, nil
+	}
+
+	if username == "" {
+		return nil, errors.New("Parse error: empty username")
+	}
+
+	return &Username{Format: UsernameSAMAccountName, User: username}, nil
+}
+
+//netBIOSCache holds the DNS domains of NetBIOS domain names found in the partitions container, keyed by upper case NetBIOS name.
+type netBIOSCache struct {
+	mu      sync.Mutex
+	domains map[string]string
+}
+
+//netBIOSCacheMu guards creating Config.resolved.
+var netBIOSCacheMu sync.Mutex
+
+//netBIOSCache returns the Config's cache of resolved NetBIOS domain names, creating it if needed.
+func (c *Config) netBIOSCache() *netBIOSCache {
+	netBIOSCacheMu.Lock()
+	defer netBIOSCacheMu.Unlock()
+	if c.resolved == nil {
+		c.resolved = &netBIOSCache{domains: make(map[string]string)}
+	}
+	return c.resolved
+}
+
+//netBIOSDomain returns the DNS domain configured in NetBIOSDomains or previously found with Conn.DNSDomain
+//for the given NetBIOS domain name.
+func (c *Config) netBIOSDomain(name string) (string, bool) {
+	for netbios, domain := range c.NetBIOSDomains {
+		if strings.EqualFold(netbios, name) {
+			return domain, true
+		}
+	}
+
+	cache := c.netBIOSCache()
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	domain, ok := cache.domains[strings.ToUpper(name)]
+	return domain, ok
+}
+
+//UPN is like Config.UPN, but NetBIOS domain names that aren't in Config.NetBIOSDomains are looked up with DNSDomain,
+//including the suffixes of usernames like "jdoe@CORP". The connection must be bound as a user that can read the configuration partition.
+func (c *Conn) UPN(username string) (string, error) {
+	u, err := ParseUsername(username)
+	if err != nil || u.Format != UsernameDownLevel {
+		return c.Config.UPN(username)
+	}
+
+	domain, err := c.DNSDomain(u.Domain)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s@%s", u.User, domain), nil
+}
+
+//DNSDomain returns the DNS domain for the given NetBIOS domain name by searching the partitions container,
+//or an error if one occurred. Found domains are cached on the Config and used by Config.UPN and Authenticate.
+func (c *Conn) DNSDomain(netbios string) (string, error) {
+	if domain, ok := c.Config.netBIOSDomain(netbios); ok {
+		return domain, nil
+	}
+
+	rootDSE, err := c.RootDSE([]string{"configurationNamingContext"})
+	if err != nil {
+		return "", err
+	}
+
+	configNC := rootDSE.GetAttributeValue("configurationNamingContext")
+	if configNC == "" {
+		return "", errors.New("Search error: configurationNamingContext not found")
+	}
+
+	filter := fmt.Sprintf("(&(objectClass=crossRef)(nETBIOSName=%s))", ldap.EscapeFilter(netbios))
+	search := ldap.NewSearchRequest(
+		"CN=Partitions,"+configNC,
+		ldap.ScopeSingleLevel,
+		ldap.NeverDerefAliases,
+		1,
+		0,
+		false,
+		filter,
+		[]string{"dnsRoot"},
+		nil,
+	)
+
+	var result *ldap.SearchResult
+	err = c.do(func() (err error) {
+		result, err = c.Conn.Search(search)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf(`Search error "%s": %w`, filter, err)
+	}
+
+	if len(result.Entries) == 0 || result.Entries[0].GetAttributeValue("dnsRoot") == "" {
+		return "", fmt.Errorf("%w: %s", ErrUnknownDomain, netbios)
+	}
+
+	domain := result.Entries[0].GetAttributeValue("dnsRoot")
+	cache := c.Config.netBIOSCache()
+	cache.mu.Lock()
+	cache.domains[strings.ToUpper(netbios)] = domain
+	cache.mu.Unlock()
+
+	return domain, nil
+}
+
+//domainDN returns the DN of the domain the server holds, read from the RootDSE's defaultNamingContext, or an error if one occurred.
+func (c *Conn) domainDN() (string, error) {
+	rootDSE, err := c.RootDSE([]string{"defaultNamingContext"})
+	if err != nil {
+		return "", err
+	}
+
+	domainDN := rootDSE.GetAttributeValue("defaultNamingContext")
+	if domainDN == "" {
+		return "", errors.New("Search error: defaultNamingContext not found")
+	}
+
+	return domainDN, nil
+}
+
+//RootDSE returns the rootDSE entry with the given attributes or an error if one occurred.
+func (c *Conn) RootDSE(attrs []string) (*ldap.Entry, error) {
+	search := ldap.NewSearchRequest("", ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, 0, false, "(objectClass=*)", attrs, nil)
+
+	var result *ldap.SearchResult
+	err := c.do(func() (err error) {
+		result, err = c.Conn.Search(search)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Search error (rootDSE): %w", err)
+	}
+
+	if len(result.Entries) == 0 {
+		return nil, errors.New("Search error (rootDSE): no entries returned")
+	}
+
+	return result.Entries[0], nil
+}
@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+func TestParseUsername(t *testing.T) {
+	tests := map[string]Username{
+		"jdoe":                  {Format: UsernameSAMAccountName, User: "jdoe"},
+		"jdoe@example.com":      {Format: UsernameUPN, User: "jdoe", Domain: "example.com"},
+		"john.doe@alt.example":  {Format: UsernameUPN, User: "john.doe", Domain: "alt.example"},
+		"jdoe@CORP":             {Format: UsernameDownLevel, User: "jdoe", Domain: "CORP"},
+		`CORP\jdoe`:             {Format: UsernameDownLevel, User: "jdoe", Domain: "CORP"},
+		`corp.example.com\jdoe`: {Format: UsernameDownLevel, User: "jdoe", Domain: "corp.example.com"},
+	}
+
+	for test, expected := range tests {
+		u, err := ParseUsername(test)
+		if err != nil {
+			t.Errorf("Failed Test: %s\n\tError: %v", test, err)
+			continue
+		}
+		if *u != expected {
+			t.Errorf("Failed Test: %s\n\tOutput: %+v Expected: %+v", test, *u, expected)
+		}
+	}
+
+	if u, _ := ParseUsername(`CORP\jdoe`); u.String() != `CORP\jdoe` {
+		t.Error("Expected down-level logon name to round trip but got:", u.String())
+	}
+
+	errorTests := []string{
+		"",
+		`CORP\`,
+		`\jdoe`,
+		`CORP\jdoe@example.com`,
+		"jdoe@",
+		"@example.com",
+	}
+	for _, test := range errorTests {
+		if _, err := ParseUsername(test); err == nil {
+			t.Errorf("Failed Test: %s\n\tError: err is nil", test)
+		}
+	}
+}
+
+func TestConfigUPNNetBIOS(t *testing.T) {
+	config := &Config{BaseDN: "DC=example,DC=com", NetBIOSDomains: map[string]string{"CORP": "corp.example.com"}}
+
+	tests := map[string]string{
+		`CORP\jdoe`:        "jdoe@corp.example.com",
+		`corp\jdoe`:        "jdoe@corp.example.com",
+		"jdoe@corp":        "jdoe@corp.example.com",
+		"jdoe@alt.example": "jdoe@alt.example",
+		"jdoe@other":       "jdoe@other",
+		"jdoe":             "jdoe@example.com",
+	}
+	for test, expected := range tests {
+		if upn, err := config.UPN(test); upn != expected {
+			t.Errorf("Failed Test: %s\n\tOutput: %s Expected: %s Error: %v", test, upn, expected, err)
+		}
+	}
+
+	if _, err := config.UPN(`OTHER\jdoe`); !errors.Is(err, ErrUnknownDomain) {
+		t.Error("Unknown domain: Expected unknown domain error but got:", err)
+	}
+}
+
+//ldapEntry returns a SearchResultEntry message with the given DN and attributes.
+func ldapEntry(id int64, dn string, attrs map[string][]string) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, ""))
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	for name, values := range attrs {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, ""))
+		}
+		attr.AppendChild(set)
+		list.AppendChild(attr)
+	}
+	op.AppendChild(list)
+	packet.AppendChild(op)
+	return packet
+}
+
+//serveNetBIOS answers requests on conn like a domain controller for CORP (corp.example.com) until it's closed.
+//Bind names are sent on binds. Searches fail until the connection is bound unless anonymous is true.
+func serveNetBIOS(conn net.Conn, binds chan<- string, anonymous bool) {
+	defer conn.Close()
+	bound := anonymous
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+
+		var out []byte
+		switch req := packet.Children[1]; req.Tag {
+		case ldap.ApplicationBindRequest:
+			binds <- req.Children[1].Data.String()
+			bound = true
+			out = ldapResponse(id, ldap.ApplicationBindResponse, ldap.LDAPResultSuccess).Bytes()
+		case ldap.ApplicationSearchRequest:
+			if !bound {
+				out = ldapResponse(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultOperationsError).Bytes()
+				break
+			}
+			switch req.Children[0].Data.String() {
+			case "":
+				out = ldapEntry(id, "", map[string][]string{"configurationNamingContext": {"CN=Configuration,DC=example,DC=com"}}).Bytes()
+			case "CN=Partitions,CN=Configuration,DC=example,DC=com":
+				out = ldapEntry(id, "CN=CORP,CN=Partitions,CN=Configuration,DC=example,DC=com", map[string][]string{"dnsRoot": {"corp.example.com"}}).Bytes()
+			}
+			out = append(out, ldapResponse(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes()...)
+		default:
+			return
+		}
+
+		if _, err = conn.Write(out); err != nil {
+			return
+		}
+	}
+}
+
+func TestAuthenticateNetBIOS(t *testing.T) {
+	for _, anonymous := range []bool{false, true} {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal("Error starting listener:", err)
+		}
+
+		binds := make(chan string, 4)
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				go serveNetBIOS(conn, binds, anonymous)
+			}
+		}()
+
+		config := &Config{Server: l.Addr().String(), Security: SecurityNone, BaseDN: "DC=example,DC=com"}
+
+		//without anonymous reads the first bind falls back to the down-level logon name and the domain is resolved afterwards
+		expected := []string{`CORP\jdoe`, "jdoe@corp.example.com"}
+		if anonymous {
+			expected[0] = "jdoe@corp.example.com"
+		}
+		for i, name := range expected {
+			status, err := Authenticate(config, `CORP\jdoe`, "secret")
+			if err != nil || !status {
+				t.Errorf("anonymous %v, bind %d: Expected true, nil but got: %v, %v", anonymous, i, status, err)
+			}
+			if bind := <-binds; bind != name {
+				t.Errorf("anonymous %v, bind %d: Expected bind as %q but got: %q", anonymous, i, name, bind)
+			}
+		}
+
+		if upn, err := config.UPN("jdoe@CORP"); err != nil || upn != "jdoe@corp.example.com" {
+			t.Errorf("anonymous %v: Expected cached UPN %q but got: %q, %v", anonymous, "jdoe@corp.example.com", upn, err)
+		}
+
+		l.Close()
+	}
+}
+
+func TestConnDNSDomain(t *testing.T) {
+	if testConfig.Server == "" {
+		t.Skip("ADTEST_SERVER not set")
+		return
+	}
+
+	if testConfig.BindUPN == "" || testConfig.BindPass == "" {
+		t.Skip("ADTEST_BIND_UPN or ADTEST_BIND_PASS not set")
+		return
+	}
+
+	if testConfig.BaseDN == "" {
+		t.Skip("ADTEST_BASEDN not set")
+		return
+	}
+
+	config := &Config{Server: testConfig.Server, Port: testConfig.Port, Security: testConfig.BindSecurity, BaseDN: testConfig.BaseDN}
+	conn, err := config.Connect()
+	if err != nil {
+		t.Fatal("Error connecting to server:", err)
+	}
+	defer conn.Conn.Close()
+
+	status, err := conn.Bind(testConfig.BindUPN, testConfig.BindPass)
+	if err != nil {
+		t.Fatal("Error binding to server:", err)
+	}
+	if !status {
+		t.Fatal("Error binding to server: invalid credentials")
+	}
+
+	if _, err = conn.DNSDomain("go-ad-auth-invalid"); !errors.Is(err, ErrUnknownDomain) {
+		t.Error("Invalid domain: Expected unknown domain error but got:", err)
+	}
+
+	domain, err := config.Domain()
+	if err != nil {
+		t.Fatal("Error getting domain:", err)
+	}
+
+	rootDSE, err := conn.RootDSE([]string{"configurationNamingContext"})
+	if err != nil {
+		t.Fatal("Error getting rootDSE:", err)
+	}
+
+	//find the NetBIOS name for the test domain
+	config.BaseDN = "CN=Partitions," + rootDSE.GetAttributeValue("configurationNamingContext")
+	entry, err := conn.SearchOne(fmt.Sprintf("(&(objectClass=crossRef)(dnsRoot=%s)(nETBIOSName=*))", domain), []string{"nETBIOSName"})
+	config.BaseDN = testConfig.BaseDN
+	if err != nil {
+		t.Fatal("Error finding NetBIOS name:", err)
+	}
+	netbios := entry.GetAttributeValue("nETBIOSName")
+
+	if dnsDomain, err := conn.DNSDomain(netbios); !strings.EqualFold(dnsDomain, domain) {
+		t.Errorf("Expected DNS domain (%s) to be equal to domain (%s): %v", dnsDomain, domain, err)
+	}
+
+	username := strings.Split(testConfig.BindUPN, "@")[0]
+	if upn, err := conn.UPN(netbios + `\` + username); !strings.EqualFold(upn, username+"@"+domain) {
+		t.Errorf("Expected UPN (%s) to be equal to %s@%s: %v", upn, username, domain, err)
+	}
+
+	if status, err = Authenticate(config, netbios+`\`+username, testConfig.BindPass); !status || err != nil {
+		t.Error("Down-level logon name: Expected authenticate status to be true but got:", err)
+	}
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//PasswordRule is a password policy rule a password can violate.
+type PasswordRule int
+
+//PasswordRules checked by PasswordPolicy.Validate.
+const (
+	//RuleMinLength is violated if the password is shorter than PasswordPolicy.MinPasswordLength.
+	RuleMinLength PasswordRule = iota
+	//RuleComplexity is violated if the password has characters from fewer than three of five categories:
+	//uppercase letters, lowercase letters, the digits 0-9, symbols (punctuation and symbol characters), and other letters
+	//(e.g. Asian scripts). Other characters, e.g. whitespace, don't belong to any category.
+	RuleComplexity
+	//RuleAccountName is violated if the password contains the sAMAccountName.
+	RuleAccountName
+	//RuleDisplayName is violated if the password contains a token of the displayName.
+	RuleDisplayName
+)
+
+func (r PasswordRule) String() string {
+	switch r {
+	case RuleMinLength:
+		return "password is too short"
+	case RuleComplexity:
+		return "password must contain characters from three of these categories: uppercase letters, lowercase letters, digits, symbols, other letters"
+	case RuleAccountName:
+		return "password must not contain the account name"
+	case RuleDisplayName:
+		return "password must not contain parts of the user's full name"
+	default:
+		return "unknown password rule"
+	}
+}
+
+//displayNameDelimiters are the characters Active Directory splits displayName into tokens with.
+const displayNameDelimiters = ",.-_ #\t"
+
+//Validate checks password locally against the policy, the same way Active Directory does, and returns the rules it violates, if any.
+//username is the sAMAccountName and displayName the displayName of the user the password is for; either may be empty.
+//The name and complexity rules are only checked if ComplexityEnabled is set.
+//The password history and minimum password age can only be checked by the server.
+func (p *PasswordPolicy) Validate(password, username, displayName string) []PasswordRule {
+	var violated []PasswordRule
+
+	if utf8.RuneCountInString(password) < p.MinPasswordLength {
+		violated = append(violated, RuleMinLength)
+	}
+
+	if !p.ComplexityEnabled {
+		return violated
+	}
+
+	if passwordCategories(password) < 3 {
+		violated = append(violated, RuleComplexity)
+	}
+
+	lower := strings.ToLower(password)
+
+	//names shorter than three characters are ignored
+	if utf8.RuneCountInString(username) >= 3 && strings.Contains(lower, strings.ToLower(username)) {
+		violated = append(violated, RuleAccountName)
+	}
+
+	tokens := strings.FieldsFunc(displayName, func(r rune) bool {
+		return strings.ContainsRune(displayNameDelimiters, r)
+	})
+	for _, token := range tokens {
+		if utf8.RuneCountInString(token) >= 3 && strings.Contains(lower, strings.ToLower(token)) {
+			violated = append(violated, RuleDisplayName)
+			break
+		}
+	}
+
+	return violated
+}
+
+//passwordCategories returns the number of Active Directory complexity categories password has characters from.
+func passwordCategories(password string) int {
+	var upper, lower, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case unicode.IsLetter(r):
+			other = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+
+	count := 0
+	for _, category := range []bool{upper, lower, digit, symbol, other} {
+		if category {
+			count++
+		}
+	}
+
+	return count
+}
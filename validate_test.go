@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := &PasswordPolicy{MinPasswordLength: 8, ComplexityEnabled: true}
+
+	tests := []struct {
+		password string
+		violated []PasswordRule
+	}{
+		{"Tr0ub4dor&3", nil},
+		{"Sh0rt!", []PasswordRule{RuleMinLength}},
+		{"alllowercase", []PasswordRule{RuleComplexity}},
+		{"lowercase123", []PasswordRule{RuleComplexity}},
+		{"lowercase12!", nil},
+		{"lowercase12 ", []PasswordRule{RuleComplexity}},
+		{"lowercase٣!", []PasswordRule{RuleComplexity}},
+		{"Password", []PasswordRule{RuleComplexity}},
+		{"ÄÖÜäöü123", nil},
+		{"密码密码密码ab", []PasswordRule{RuleComplexity}},
+		{"密码密码密码a1", nil},
+		{"xJDoe-2023!", []PasswordRule{RuleAccountName}},
+		{"Smith#2023x", []PasswordRule{RuleDisplayName}},
+		{"Jo#2023xyzQ", nil},
+		{"jdoe", []PasswordRule{RuleMinLength, RuleComplexity, RuleAccountName}},
+	}
+
+	for _, test := range tests {
+		violated := policy.Validate(test.password, "jdoe", "Smith-Jones, Jo")
+		if !reflect.DeepEqual(violated, test.violated) {
+			t.Errorf("expected violated rules for %s to be equal: want: %v, have: %v", test.password, test.violated, violated)
+		}
+	}
+
+	policy.ComplexityEnabled = false
+	if violated := policy.Validate("jdoejdoe", "jdoe", "John Doe"); violated != nil {
+		t.Error("expected complexity rules to not be checked but got:", violated)
+	}
+
+	if violated := policy.Validate("jdoe", "", ""); !reflect.DeepEqual(violated, []PasswordRule{RuleMinLength}) {
+		t.Error("expected length rule to be checked but got:", violated)
+	}
+}